@@ -0,0 +1,190 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import "os"
+
+// Result of an asynchronous command, result sets are stored and must be freed
+type AsyncResult PipelineResult
+
+// Send a query asynchronously, the result is sent on the returned channel
+// once the query has run. The query is not sent if cancel receives a value
+// or is closed before the query is run, cancel may be nil
+func (c *Client) QueryAsync(sql string, cancel <-chan bool) <-chan *AsyncResult {
+	// Log query
+	c.log(1, "=== Begin async query '%s' ===", sql)
+	p := c.Pipeline()
+	p.Query(sql)
+	return c.runAsync(p, cancel)
+}
+
+// Execute a statement asynchronously with the currently bound params, params
+// can be bound again once the execute is queued
+func (s *Statement) ExecuteAsync(cancel <-chan bool) <-chan *AsyncResult {
+	// Log execute
+	s.c.log(1, "=== Begin async execute ===")
+	p := s.c.Pipeline()
+	p.Execute(s)
+	return s.c.runAsync(p, cancel)
+}
+
+// Send a query asynchronously and stream the rows of the first result set,
+// rows are sent as they are read and the channel is closed after the last
+// row. The result is sent on done once all rows have been sent, rows must
+// be read until the channel is closed unless cancel is used to stop early
+func (c *Client) QueryStreamAsync(sql string, cancel <-chan bool) (rows <-chan Row, done <-chan *AsyncResult) {
+	// Log query
+	c.log(1, "=== Begin async query stream '%s' ===", sql)
+	rowChan := make(chan Row)
+	doneChan := make(chan *AsyncResult, 1)
+	if err := c.checkAsync(); err != nil {
+		close(rowChan)
+		doneChan <- &AsyncResult{Err: err}
+		return rowChan, doneChan
+	}
+	c.enqueue(func() {
+		res := new(AsyncResult)
+		defer func() {
+			close(rowChan)
+			doneChan <- res
+		}()
+		if isCancelled(cancel) {
+			res.Err = &ClientError{CR_COMMAND_CANCELLED, CR_COMMAND_CANCELLED_STR, nil}
+			return
+		}
+		res.Err = c.Query(sql)
+		if res.Err != nil {
+			return
+		}
+		res.AffectedRows = c.AffectedRows
+		res.LastInsertId = c.LastInsertId
+		res.Warnings = c.Warnings
+		if !c.checkResult() {
+			return
+		}
+		res.Err = c.streamRows(rowChan, cancel)
+	})
+	return rowChan, doneChan
+}
+
+// Send the rows of the current result to ch, the result and any further
+// results are freed afterwards
+func (c *Client) streamRows(ch chan<- Row, cancel <-chan bool) (err os.Error) {
+	r, err := c.UseResult()
+	if err != nil {
+		return
+	}
+	var row Row
+	for {
+		row, err = r.fetchRow()
+		if err != nil {
+			// Result is reset if the client reconnects
+			err = c.simpleReconnect(err)
+			if c.checkResult() {
+				c.FreeResult()
+			}
+			return
+		}
+		if row == nil {
+			break
+		}
+		select {
+		case ch <- row:
+		case <-cancel:
+			err = &ClientError{CR_COMMAND_CANCELLED, CR_COMMAND_CANCELLED_STR, nil}
+		}
+		if err != nil {
+			break
+		}
+	}
+	// Free the result, discarding any further results
+	fErr := c.FreeResult()
+	for fErr == nil && c.MoreResults() {
+		_, fErr = c.NextResult()
+		if fErr == nil && c.checkResult() {
+			fErr = c.FreeResult()
+		}
+	}
+	if err == nil {
+		err = fErr
+	}
+	return
+}
+
+// Run a pipeline of 1 command asynchronously
+func (c *Client) runAsync(p *Pipeline, cancel <-chan bool) <-chan *AsyncResult {
+	ch := make(chan *AsyncResult, 1)
+	if err := c.checkAsync(); err != nil {
+		ch <- &AsyncResult{Err: err}
+		return ch
+	}
+	c.enqueue(func() {
+		if isCancelled(cancel) {
+			ch <- &AsyncResult{Err: &ClientError{CR_COMMAND_CANCELLED, CR_COMMAND_CANCELLED_STR, nil}}
+			return
+		}
+		results, err := p.Run()
+		if err != nil {
+			ch <- &AsyncResult{Err: err}
+			return
+		}
+		ch <- (*AsyncResult)(results[0])
+	})
+	return ch
+}
+
+// Check asynchronous commands can be queued, internal locking must already
+// be enabled so commands called directly from other goroutines wait for the
+// queue
+func (c *Client) checkAsync() os.Error {
+	if !c.Locking {
+		c.log(1, "!!! Locking must be enabled for asynchronous commands !!!")
+		return &ClientError{CR_ASYNC_LOCKING_REQUIRED, CR_ASYNC_LOCKING_REQUIRED_STR, nil}
+	}
+	return nil
+}
+
+// Add a function to the async queue, a goroutine is started to run queued
+// functions in order and exits once the queue is empty
+func (c *Client) enqueue(fn func()) {
+	c.asyncMutex.Lock()
+	c.asyncQueue = append(c.asyncQueue, fn)
+	start := !c.asyncRunning
+	c.asyncRunning = true
+	c.asyncMutex.Unlock()
+	if start {
+		go c.runQueue()
+	}
+}
+
+// Run queued functions until the queue is empty
+func (c *Client) runQueue() {
+	for {
+		c.asyncMutex.Lock()
+		if len(c.asyncQueue) == 0 {
+			c.asyncRunning = false
+			c.asyncMutex.Unlock()
+			return
+		}
+		fn := c.asyncQueue[0]
+		c.asyncQueue = c.asyncQueue[1:]
+		c.asyncMutex.Unlock()
+		fn()
+	}
+}
+
+// Check if a cancel channel has received a value or been closed
+func isCancelled(cancel <-chan bool) bool {
+	if cancel == nil {
+		return false
+	}
+	select {
+	case <-cancel:
+		return true
+	default:
+	}
+	return false
+}
@@ -59,6 +59,12 @@ const (
 	CLIENT_SECURE_CONN
 	CLIENT_MULTI_STATEMENTS
 	CLIENT_MULTI_RESULTS
+	CLIENT_PS_MULTI_RESULTS
+	CLIENT_PLUGIN_AUTH
+	CLIENT_CONNECT_ATTRS
+	CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA
+	CLIENT_CAN_HANDLE_EXPIRED_PASSWORDS
+	CLIENT_SESSION_TRACK
 )
 
 type ServerStatus uint16
@@ -77,6 +83,17 @@ const (
 	SERVER_STATUS_DB_DROPPED
 	SERVER_STATUS_NO_BACKSLASH_ESCAPES
 	SERVER_STATUS_METADATA_CHANGED
+	SERVER_QUERY_WAS_SLOW
+	SERVER_PS_OUT_PARAMS
+	SERVER_STATUS_IN_TRANS_READONLY
+	SERVER_SESSION_STATE_CHANGED
+)
+
+// Session state change types
+const (
+	SESSION_TRACK_SYSTEM_VARIABLES = iota
+	SESSION_TRACK_SCHEMA
+	SESSION_TRACK_STATE_CHANGE
 )
 
 type FieldType byte
@@ -114,6 +131,48 @@ const (
 	FIELD_TYPE_GEOMETRY
 )
 
+// Field type names
+var fieldTypeNames = map[FieldType]string{
+	FIELD_TYPE_DECIMAL:     "DECIMAL",
+	FIELD_TYPE_TINY:        "TINY",
+	FIELD_TYPE_SHORT:       "SHORT",
+	FIELD_TYPE_LONG:        "LONG",
+	FIELD_TYPE_FLOAT:       "FLOAT",
+	FIELD_TYPE_DOUBLE:      "DOUBLE",
+	FIELD_TYPE_NULL:        "NULL",
+	FIELD_TYPE_TIMESTAMP:   "TIMESTAMP",
+	FIELD_TYPE_LONGLONG:    "LONGLONG",
+	FIELD_TYPE_INT24:       "INT24",
+	FIELD_TYPE_DATE:        "DATE",
+	FIELD_TYPE_TIME:        "TIME",
+	FIELD_TYPE_DATETIME:    "DATETIME",
+	FIELD_TYPE_YEAR:        "YEAR",
+	FIELD_TYPE_NEWDATE:     "NEWDATE",
+	FIELD_TYPE_VARCHAR:     "VARCHAR",
+	FIELD_TYPE_BIT:         "BIT",
+	FIELD_TYPE_NEWDECIMAL:  "NEWDECIMAL",
+	FIELD_TYPE_ENUM:        "ENUM",
+	FIELD_TYPE_SET:         "SET",
+	FIELD_TYPE_TINY_BLOB:   "TINY_BLOB",
+	FIELD_TYPE_MEDIUM_BLOB: "MEDIUM_BLOB",
+	FIELD_TYPE_LONG_BLOB:   "LONG_BLOB",
+	FIELD_TYPE_BLOB:        "BLOB",
+	FIELD_TYPE_VAR_STRING:  "VAR_STRING",
+	FIELD_TYPE_STRING:      "STRING",
+	FIELD_TYPE_GEOMETRY:    "GEOMETRY",
+}
+
+// Get field type name
+func (t FieldType) String() string {
+	if name, ok := fieldTypeNames[t]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Binary charset number
+const CHARSET_BINARY = 63
+
 type FieldFlag uint16
 
 const (
@@ -6,6 +6,7 @@
 package mysql
 
 import (
+	"fmt"
 	"math"
 	"os"
 	"strconv"
@@ -285,3 +286,77 @@ func atos(i interface{}) (s string) {
 	}
 	return
 }
+
+// any to DateTime
+func atodt(i interface{}) (d DateTime) {
+	switch t := i.(type) {
+	case DateTime:
+		return t
+	case Date:
+		d.Year, d.Month, d.Day = t.Year, t.Month, t.Day
+	case Time:
+		d.Hour, d.Minute, d.Second = t.Hour, t.Minute, t.Second
+	default:
+		panic("Not a date/time type")
+	}
+	return
+}
+
+// any to byte slice
+func atob(i interface{}) (b []byte) {
+	switch t := i.(type) {
+	case []byte:
+		return t
+	case string:
+		b = []byte(t)
+	default:
+		b = []byte(atos(i))
+	}
+	return
+}
+
+// Date to bytes (MYSQL_TIME format)
+func datetob(d Date) (b []byte) {
+	b = []byte{4}
+	b = append(b, ui16tob(d.Year)...)
+	b = append(b, d.Month, d.Day)
+	return
+}
+
+// Time to bytes (MYSQL_TIME format), time is never negative and days are unused
+func timetob(t Time) (b []byte) {
+	b = []byte{8, 0x0}
+	b = append(b, ui32tob(0)...)
+	b = append(b, t.Hour, t.Minute, t.Second)
+	return
+}
+
+// DateTime to bytes (MYSQL_TIME format)
+func datetimetob(d DateTime) (b []byte) {
+	b = []byte{7}
+	b = append(b, ui16tob(d.Year)...)
+	b = append(b, d.Month, d.Day, d.Hour, d.Minute, d.Second)
+	return
+}
+
+// string to Date
+func stodate(s string) (d Date, err os.Error) {
+	_, err = fmt.Sscanf(s, "%d-%d-%d", &d.Year, &d.Month, &d.Day)
+	return
+}
+
+// string to Time
+func stotime(s string) (t Time, err os.Error) {
+	_, err = fmt.Sscanf(s, "%d:%d:%d", &t.Hour, &t.Minute, &t.Second)
+	return
+}
+
+// string to DateTime, the time is optional
+func stodatetime(s string) (d DateTime, err os.Error) {
+	if len(s) <= 10 {
+		_, err = fmt.Sscanf(s, "%d-%d-%d", &d.Year, &d.Month, &d.Day)
+		return
+	}
+	_, err = fmt.Sscanf(s, "%d-%d-%d %d:%d:%d", &d.Year, &d.Month, &d.Day, &d.Hour, &d.Minute, &d.Second)
+	return
+}
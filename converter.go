@@ -0,0 +1,288 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"fmt"
+	"math"
+	"mysql/geometry"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Implemented by types which can convert themselves to a supported
+// parameter type e.g. a string or int64
+type ValueConverter interface {
+	ConvertValue() (interface{}, os.Error)
+}
+
+// Implemented by types which can populate themselves from a row value,
+// value is nil for NULL columns
+type Scanner interface {
+	Scan(value interface{}) os.Error
+}
+
+// Conversion functions for types that can't implement the interfaces
+type ConvertFunc func(param interface{}) (interface{}, os.Error)
+type ScanFunc func(dst, value interface{}) os.Error
+
+// Registered type conversions
+type conversion struct {
+	convert ConvertFunc
+	scan    ScanFunc
+}
+
+var (
+	conversions     = make(map[reflect.Type]*conversion)
+	conversionsLock sync.RWMutex
+)
+
+// Register conversion functions for a type that doesn't implement ValueConverter
+// or Scanner, typ should be a value of the type e.g. net.IP{}. The convert
+// function is used for parameters of the type or a pointer to it, the scan
+// function is used for results bound to a pointer to the type. Either function
+// can be nil.
+func RegisterType(typ interface{}, convert ConvertFunc, scan ScanFunc) {
+	conversionsLock.Lock()
+	defer conversionsLock.Unlock()
+	conversions[reflect.TypeOf(typ)] = &conversion{convert, scan}
+}
+
+// Get a registered conversion
+func lookupConversion(t reflect.Type) *conversion {
+	conversionsLock.RLock()
+	defer conversionsLock.RUnlock()
+	return conversions[t]
+}
+
+// Get a registered scan function for a result pointer
+func lookupScan(t reflect.Type) ScanFunc {
+	if t.Kind() != reflect.Ptr {
+		return nil
+	}
+	if conv := lookupConversion(t.Elem()); conv != nil {
+		return conv.scan
+	}
+	return nil
+}
+
+// Convert a custom parameter type to a supported type
+func convertParam(param interface{}) (interface{}, os.Error) {
+	// Nil and types implementing the interface
+	if param == nil {
+		return nil, nil
+	}
+	if vc, ok := param.(ValueConverter); ok {
+		return vc.ConvertValue()
+	}
+	// Registered types, for pointers also check the pointed to type
+	t := reflect.TypeOf(param)
+	conv := lookupConversion(t)
+	if conv == nil && t.Kind() == reflect.Ptr {
+		conv = lookupConversion(t.Elem())
+	}
+	if conv != nil && conv.convert != nil {
+		return conv.convert(param)
+	}
+	return param, nil
+}
+
+// Assign a row to a set of result pointers
+func scanRow(row Row, dest []interface{}) (err os.Error) {
+	// Recover possible errors from type conversion
+	defer func() {
+		if e := recover(); e != nil {
+			err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
+			return
+		}
+	}()
+	// Check there are enough columns
+	if len(dest) > len(row) {
+		return &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR, nil}
+	}
+	// Iterate bound params and assign from row (partial set quicker this way)
+	for k, v := range dest {
+		err = bindValue(v, row[k], k)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Assign a row value to a bound result pointer
+func bindValue(dst, val interface{}, k int) (err os.Error) {
+	// Unbound column
+	if dst == nil {
+		return
+	}
+	// Custom types
+	if sc, ok := dst.(Scanner); ok {
+		return sc.Scan(val)
+	}
+	if fn := lookupScan(reflect.TypeOf(dst)); fn != nil {
+		return fn(dst, val)
+	}
+	// Null values set the target to its zero value, nil for pointers
+	if val == nil {
+		if v := reflect.ValueOf(dst); v.Kind() == reflect.Ptr && !v.IsNil() {
+			v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		}
+		return
+	}
+	switch t := dst.(type) {
+	// Integer types
+	case *int:
+		*t = int(atoui64(val))
+	case *uint:
+		*t = uint(atoui64(val))
+	case *int8:
+		*t = int8(atoui64(val))
+	case *uint8:
+		*t = uint8(atoui64(val))
+	case *int16:
+		*t = int16(atoui64(val))
+	case *uint16:
+		*t = uint16(atoui64(val))
+	case *int32:
+		*t = int32(atoui64(val))
+	case *uint32:
+		*t = uint32(atoui64(val))
+	case *int64:
+		*t = int64(atoui64(val))
+	case *uint64:
+		*t = atoui64(val)
+	// Floating point types
+	case *float32:
+		*t = float32(atof64(val))
+	case *float64:
+		*t = atof64(val)
+	// Byte slice
+	case *[]byte:
+		*t = atob(val)
+	// Strings
+	case *string:
+		*t = atos(val)
+	// Date/time, assertion
+	case *Date:
+		*t = val.(Date)
+	case *Time:
+		*t = val.(Time)
+	case *DateTime:
+		*t = val.(DateTime)
+	// Spatial value
+	case *geometry.Value:
+		var g *geometry.Value
+		g, err = geometry.Decode(val.([]byte))
+		if err != nil {
+			return
+		}
+		*t = *g
+	// Nullable types
+	case *NullInt64:
+		t.Int64, t.Valid = int64(atoui64(val)), true
+	case *NullUint64:
+		t.Uint64, t.Valid = atoui64(val), true
+	case *NullFloat64:
+		t.Float64, t.Valid = atof64(val), true
+	case *NullString:
+		t.String, t.Valid = atos(val), true
+	case *NullBytes:
+		t.Bytes, t.Valid = atob(val), true
+	case *NullTime:
+		t.DateTime, t.Valid = atodt(val), true
+	// Pointer to pointer, allocate a new value
+	default:
+		v := reflect.ValueOf(dst)
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Ptr {
+			n := reflect.New(v.Elem().Type().Elem())
+			err = bindValue(n.Interface(), val, k)
+			if err == nil {
+				v.Elem().Set(n)
+			}
+			return
+		}
+		err = &ClientError{CR_UNSUPPORTED_PARAM_TYPE, Error(fmt.Sprintf(string(CR_UNSUPPORTED_PARAM_TYPE_STR), v.Type(), k)), nil}
+	}
+	return
+}
+
+// Convert a parameter to the type expected by the server, ok is false if the
+// value is not compatible
+func coerceParam(param interface{}, p *Param) (v interface{}, ok bool) {
+	// Null is always allowed
+	if param == nil {
+		return nil, true
+	}
+	rv := reflect.ValueOf(param)
+	switch p.Type {
+	// Decimals, sent as strings to prevent loss of precision
+	case FIELD_TYPE_DECIMAL, FIELD_TYPE_NEWDECIMAL:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.Itoa64(rv.Int()), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return strconv.Uitoa64(rv.Uint()), true
+		case reflect.Float32, reflect.Float64:
+			return strconv.Ftoa64(rv.Float(), 'f', -1), true
+		case reflect.String:
+			_, err := strconv.Atof64(rv.String())
+			return param, err == nil
+		}
+	// Integers
+	case FIELD_TYPE_TINY, FIELD_TYPE_SHORT, FIELD_TYPE_INT24, FIELD_TYPE_LONG, FIELD_TYPE_LONGLONG, FIELD_TYPE_YEAR:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := rv.Float()
+			return int64(f), f == math.Floor(f)
+		case reflect.String:
+			if p.Flags&FLAG_UNSIGNED > 0 {
+				n, err := strconv.Atoui64(rv.String())
+				return n, err == nil
+			}
+			n, err := strconv.Atoi64(rv.String())
+			return n, err == nil
+		}
+	// Floating point
+	case FIELD_TYPE_FLOAT, FIELD_TYPE_DOUBLE:
+		if rv.Kind() == reflect.String {
+			f, err := strconv.Atof64(rv.String())
+			return f, err == nil
+		}
+	// Date
+	case FIELD_TYPE_DATE, FIELD_TYPE_NEWDATE:
+		switch t := param.(type) {
+		case string:
+			d, err := stodate(t)
+			return d, err == nil
+		case Time:
+			return nil, false
+		}
+	// Date/time
+	case FIELD_TYPE_DATETIME, FIELD_TYPE_TIMESTAMP:
+		switch t := param.(type) {
+		case string:
+			d, err := stodatetime(t)
+			return d, err == nil
+		case Date:
+			return atodt(t), true
+		case Time:
+			return nil, false
+		}
+	// Time
+	case FIELD_TYPE_TIME:
+		switch t := param.(type) {
+		case string:
+			d, err := stotime(t)
+			return d, err == nil
+		case Date:
+			return nil, false
+		}
+	}
+	return param, true
+}
@@ -0,0 +1,275 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+// Server error numbers, from include/mysqld_error.h. The contiguous range
+// 1000-1242 is complete, later errors are a selection of those most likely to
+// be handled by applications, up to 1614 from MySQL 5.5 and 1792 which was
+// added in MySQL 5.6
+const (
+	ER_HASHCHK                            Errno = 1000
+	ER_NISAMCHK                           Errno = 1001
+	ER_NO                                 Errno = 1002
+	ER_YES                                Errno = 1003
+	ER_CANT_CREATE_FILE                   Errno = 1004
+	ER_CANT_CREATE_TABLE                  Errno = 1005
+	ER_CANT_CREATE_DB                     Errno = 1006
+	ER_DB_CREATE_EXISTS                   Errno = 1007
+	ER_DB_DROP_EXISTS                     Errno = 1008
+	ER_DB_DROP_DELETE                     Errno = 1009
+	ER_DB_DROP_RMDIR                      Errno = 1010
+	ER_CANT_DELETE_FILE                   Errno = 1011
+	ER_CANT_FIND_SYSTEM_REC               Errno = 1012
+	ER_CANT_GET_STAT                      Errno = 1013
+	ER_CANT_GET_WD                        Errno = 1014
+	ER_CANT_LOCK                          Errno = 1015
+	ER_CANT_OPEN_FILE                     Errno = 1016
+	ER_FILE_NOT_FOUND                     Errno = 1017
+	ER_CANT_READ_DIR                      Errno = 1018
+	ER_CANT_SET_WD                        Errno = 1019
+	ER_CHECKREAD                          Errno = 1020
+	ER_DISK_FULL                          Errno = 1021
+	ER_DUP_KEY                            Errno = 1022
+	ER_ERROR_ON_CLOSE                     Errno = 1023
+	ER_ERROR_ON_READ                      Errno = 1024
+	ER_ERROR_ON_RENAME                    Errno = 1025
+	ER_ERROR_ON_WRITE                     Errno = 1026
+	ER_FILE_USED                          Errno = 1027
+	ER_FILSORT_ABORT                      Errno = 1028
+	ER_FORM_NOT_FOUND                     Errno = 1029
+	ER_GET_ERRNO                          Errno = 1030
+	ER_ILLEGAL_HA                         Errno = 1031
+	ER_KEY_NOT_FOUND                      Errno = 1032
+	ER_NOT_FORM_FILE                      Errno = 1033
+	ER_NOT_KEYFILE                        Errno = 1034
+	ER_OLD_KEYFILE                        Errno = 1035
+	ER_OPEN_AS_READONLY                   Errno = 1036
+	ER_OUTOFMEMORY                        Errno = 1037
+	ER_OUT_OF_SORTMEMORY                  Errno = 1038
+	ER_UNEXPECTED_EOF                     Errno = 1039
+	ER_CON_COUNT_ERROR                    Errno = 1040
+	ER_OUT_OF_RESOURCES                   Errno = 1041
+	ER_BAD_HOST_ERROR                     Errno = 1042
+	ER_HANDSHAKE_ERROR                    Errno = 1043
+	ER_DBACCESS_DENIED_ERROR              Errno = 1044
+	ER_ACCESS_DENIED_ERROR                Errno = 1045
+	ER_NO_DB_ERROR                        Errno = 1046
+	ER_UNKNOWN_COM_ERROR                  Errno = 1047
+	ER_BAD_NULL_ERROR                     Errno = 1048
+	ER_BAD_DB_ERROR                       Errno = 1049
+	ER_TABLE_EXISTS_ERROR                 Errno = 1050
+	ER_BAD_TABLE_ERROR                    Errno = 1051
+	ER_NON_UNIQ_ERROR                     Errno = 1052
+	ER_SERVER_SHUTDOWN                    Errno = 1053
+	ER_BAD_FIELD_ERROR                    Errno = 1054
+	ER_WRONG_FIELD_WITH_GROUP             Errno = 1055
+	ER_WRONG_GROUP_FIELD                  Errno = 1056
+	ER_WRONG_SUM_SELECT                   Errno = 1057
+	ER_WRONG_VALUE_COUNT                  Errno = 1058
+	ER_TOO_LONG_IDENT                     Errno = 1059
+	ER_DUP_FIELDNAME                      Errno = 1060
+	ER_DUP_KEYNAME                        Errno = 1061
+	ER_DUP_ENTRY                          Errno = 1062
+	ER_WRONG_FIELD_SPEC                   Errno = 1063
+	ER_PARSE_ERROR                        Errno = 1064
+	ER_EMPTY_QUERY                        Errno = 1065
+	ER_NONUNIQ_TABLE                      Errno = 1066
+	ER_INVALID_DEFAULT                    Errno = 1067
+	ER_MULTIPLE_PRI_KEY                   Errno = 1068
+	ER_TOO_MANY_KEYS                      Errno = 1069
+	ER_TOO_MANY_KEY_PARTS                 Errno = 1070
+	ER_TOO_LONG_KEY                       Errno = 1071
+	ER_KEY_COLUMN_DOES_NOT_EXITS          Errno = 1072
+	ER_BLOB_USED_AS_KEY                   Errno = 1073
+	ER_TOO_BIG_FIELDLENGTH                Errno = 1074
+	ER_WRONG_AUTO_KEY                     Errno = 1075
+	ER_READY                              Errno = 1076
+	ER_NORMAL_SHUTDOWN                    Errno = 1077
+	ER_GOT_SIGNAL                         Errno = 1078
+	ER_SHUTDOWN_COMPLETE                  Errno = 1079
+	ER_FORCING_CLOSE                      Errno = 1080
+	ER_IPSOCK_ERROR                       Errno = 1081
+	ER_NO_SUCH_INDEX                      Errno = 1082
+	ER_WRONG_FIELD_TERMINATORS            Errno = 1083
+	ER_BLOBS_AND_NO_TERMINATED            Errno = 1084
+	ER_TEXTFILE_NOT_READABLE              Errno = 1085
+	ER_FILE_EXISTS_ERROR                  Errno = 1086
+	ER_LOAD_INFO                          Errno = 1087
+	ER_ALTER_INFO                         Errno = 1088
+	ER_WRONG_SUB_KEY                      Errno = 1089
+	ER_CANT_REMOVE_ALL_FIELDS             Errno = 1090
+	ER_CANT_DROP_FIELD_OR_KEY             Errno = 1091
+	ER_INSERT_INFO                        Errno = 1092
+	ER_UPDATE_TABLE_USED                  Errno = 1093
+	ER_NO_SUCH_THREAD                     Errno = 1094
+	ER_KILL_DENIED_ERROR                  Errno = 1095
+	ER_NO_TABLES_USED                     Errno = 1096
+	ER_TOO_BIG_SET                        Errno = 1097
+	ER_NO_UNIQUE_LOGFILE                  Errno = 1098
+	ER_TABLE_NOT_LOCKED_FOR_WRITE         Errno = 1099
+	ER_TABLE_NOT_LOCKED                   Errno = 1100
+	ER_BLOB_CANT_HAVE_DEFAULT             Errno = 1101
+	ER_WRONG_DB_NAME                      Errno = 1102
+	ER_WRONG_TABLE_NAME                   Errno = 1103
+	ER_TOO_BIG_SELECT                     Errno = 1104
+	ER_UNKNOWN_ERROR                      Errno = 1105
+	ER_UNKNOWN_PROCEDURE                  Errno = 1106
+	ER_WRONG_PARAMCOUNT_TO_PROCEDURE      Errno = 1107
+	ER_WRONG_PARAMETERS_TO_PROCEDURE      Errno = 1108
+	ER_UNKNOWN_TABLE                      Errno = 1109
+	ER_FIELD_SPECIFIED_TWICE              Errno = 1110
+	ER_INVALID_GROUP_FUNC_USE             Errno = 1111
+	ER_UNSUPPORTED_EXTENSION              Errno = 1112
+	ER_TABLE_MUST_HAVE_COLUMNS            Errno = 1113
+	ER_RECORD_FILE_FULL                   Errno = 1114
+	ER_UNKNOWN_CHARACTER_SET              Errno = 1115
+	ER_TOO_MANY_TABLES                    Errno = 1116
+	ER_TOO_MANY_FIELDS                    Errno = 1117
+	ER_TOO_BIG_ROWSIZE                    Errno = 1118
+	ER_STACK_OVERRUN                      Errno = 1119
+	ER_WRONG_OUTER_JOIN                   Errno = 1120
+	ER_NULL_COLUMN_IN_INDEX               Errno = 1121
+	ER_CANT_FIND_UDF                      Errno = 1122
+	ER_CANT_INITIALIZE_UDF                Errno = 1123
+	ER_UDF_NO_PATHS                       Errno = 1124
+	ER_UDF_EXISTS                         Errno = 1125
+	ER_CANT_OPEN_LIBRARY                  Errno = 1126
+	ER_CANT_FIND_DL_ENTRY                 Errno = 1127
+	ER_FUNCTION_NOT_DEFINED               Errno = 1128
+	ER_HOST_IS_BLOCKED                    Errno = 1129
+	ER_HOST_NOT_PRIVILEGED                Errno = 1130
+	ER_PASSWORD_ANONYMOUS_USER            Errno = 1131
+	ER_PASSWORD_NOT_ALLOWED               Errno = 1132
+	ER_PASSWORD_NO_MATCH                  Errno = 1133
+	ER_UPDATE_INFO                        Errno = 1134
+	ER_CANT_CREATE_THREAD                 Errno = 1135
+	ER_WRONG_VALUE_COUNT_ON_ROW           Errno = 1136
+	ER_CANT_REOPEN_TABLE                  Errno = 1137
+	ER_INVALID_USE_OF_NULL                Errno = 1138
+	ER_REGEXP_ERROR                       Errno = 1139
+	ER_MIX_OF_GROUP_FUNC_AND_FIELDS       Errno = 1140
+	ER_NONEXISTING_GRANT                  Errno = 1141
+	ER_TABLEACCESS_DENIED_ERROR           Errno = 1142
+	ER_COLUMNACCESS_DENIED_ERROR          Errno = 1143
+	ER_ILLEGAL_GRANT_FOR_TABLE            Errno = 1144
+	ER_GRANT_WRONG_HOST_OR_USER           Errno = 1145
+	ER_NO_SUCH_TABLE                      Errno = 1146
+	ER_NONEXISTING_TABLE_GRANT            Errno = 1147
+	ER_NOT_ALLOWED_COMMAND                Errno = 1148
+	ER_SYNTAX_ERROR                       Errno = 1149
+	ER_DELAYED_CANT_CHANGE_LOCK           Errno = 1150
+	ER_TOO_MANY_DELAYED_THREADS           Errno = 1151
+	ER_ABORTING_CONNECTION                Errno = 1152
+	ER_NET_PACKET_TOO_LARGE               Errno = 1153
+	ER_NET_READ_ERROR_FROM_PIPE           Errno = 1154
+	ER_NET_FCNTL_ERROR                    Errno = 1155
+	ER_NET_PACKETS_OUT_OF_ORDER           Errno = 1156
+	ER_NET_UNCOMPRESS_ERROR               Errno = 1157
+	ER_NET_READ_ERROR                     Errno = 1158
+	ER_NET_READ_INTERRUPTED               Errno = 1159
+	ER_NET_ERROR_ON_WRITE                 Errno = 1160
+	ER_NET_WRITE_INTERRUPTED              Errno = 1161
+	ER_TOO_LONG_STRING                    Errno = 1162
+	ER_TABLE_CANT_HANDLE_BLOB             Errno = 1163
+	ER_TABLE_CANT_HANDLE_AUTO_INCREMENT   Errno = 1164
+	ER_DELAYED_INSERT_TABLE_LOCKED        Errno = 1165
+	ER_WRONG_COLUMN_NAME                  Errno = 1166
+	ER_WRONG_KEY_COLUMN                   Errno = 1167
+	ER_WRONG_MRG_TABLE                    Errno = 1168
+	ER_DUP_UNIQUE                         Errno = 1169
+	ER_BLOB_KEY_WITHOUT_LENGTH            Errno = 1170
+	ER_PRIMARY_CANT_HAVE_NULL             Errno = 1171
+	ER_TOO_MANY_ROWS                      Errno = 1172
+	ER_REQUIRES_PRIMARY_KEY               Errno = 1173
+	ER_NO_RAID_COMPILED                   Errno = 1174
+	ER_UPDATE_WITHOUT_KEY_IN_SAFE_MODE    Errno = 1175
+	ER_KEY_DOES_NOT_EXITS                 Errno = 1176
+	ER_CHECK_NO_SUCH_TABLE                Errno = 1177
+	ER_CHECK_NOT_IMPLEMENTED              Errno = 1178
+	ER_CANT_DO_THIS_DURING_AN_TRANSACTION Errno = 1179
+	ER_ERROR_DURING_COMMIT                Errno = 1180
+	ER_ERROR_DURING_ROLLBACK              Errno = 1181
+	ER_ERROR_DURING_FLUSH_LOGS            Errno = 1182
+	ER_ERROR_DURING_CHECKPOINT            Errno = 1183
+	ER_NEW_ABORTING_CONNECTION            Errno = 1184
+	ER_DUMP_NOT_IMPLEMENTED               Errno = 1185
+	ER_FLUSH_MASTER_BINLOG_CLOSED         Errno = 1186
+	ER_INDEX_REBUILD                      Errno = 1187
+	ER_MASTER                             Errno = 1188
+	ER_MASTER_NET_READ                    Errno = 1189
+	ER_MASTER_NET_WRITE                   Errno = 1190
+	ER_FT_MATCHING_KEY_NOT_FOUND          Errno = 1191
+	ER_LOCK_OR_ACTIVE_TRANSACTION         Errno = 1192
+	ER_UNKNOWN_SYSTEM_VARIABLE            Errno = 1193
+	ER_CRASHED_ON_USAGE                   Errno = 1194
+	ER_CRASHED_ON_REPAIR                  Errno = 1195
+	ER_WARNING_NOT_COMPLETE_ROLLBACK      Errno = 1196
+	ER_TRANS_CACHE_FULL                   Errno = 1197
+	ER_SLAVE_MUST_STOP                    Errno = 1198
+	ER_SLAVE_NOT_RUNNING                  Errno = 1199
+	ER_BAD_SLAVE                          Errno = 1200
+	ER_MASTER_INFO                        Errno = 1201
+	ER_SLAVE_THREAD                       Errno = 1202
+	ER_TOO_MANY_USER_CONNECTIONS          Errno = 1203
+	ER_SET_CONSTANTS_ONLY                 Errno = 1204
+	ER_LOCK_WAIT_TIMEOUT                  Errno = 1205
+	ER_LOCK_TABLE_FULL                    Errno = 1206
+	ER_READ_ONLY_TRANSACTION              Errno = 1207
+	ER_DROP_DB_WITH_READ_LOCK             Errno = 1208
+	ER_CREATE_DB_WITH_READ_LOCK           Errno = 1209
+	ER_WRONG_ARGUMENTS                    Errno = 1210
+	ER_NO_PERMISSION_TO_CREATE_USER       Errno = 1211
+	ER_UNION_TABLES_IN_DIFFERENT_DIR      Errno = 1212
+	ER_LOCK_DEADLOCK                      Errno = 1213
+	ER_TABLE_CANT_HANDLE_FT               Errno = 1214
+	ER_CANNOT_ADD_FOREIGN                 Errno = 1215
+	ER_NO_REFERENCED_ROW                  Errno = 1216
+	ER_ROW_IS_REFERENCED                  Errno = 1217
+	ER_CONNECT_TO_MASTER                  Errno = 1218
+	ER_QUERY_ON_MASTER                    Errno = 1219
+	ER_ERROR_WHEN_EXECUTING_COMMAND       Errno = 1220
+	ER_WRONG_USAGE                        Errno = 1221
+	ER_WRONG_NUMBER_OF_COLUMNS_IN_SELECT  Errno = 1222
+	ER_CANT_UPDATE_WITH_READLOCK          Errno = 1223
+	ER_MIXING_NOT_ALLOWED                 Errno = 1224
+	ER_DUP_ARGUMENT                       Errno = 1225
+	ER_USER_LIMIT_REACHED                 Errno = 1226
+	ER_SPECIFIC_ACCESS_DENIED_ERROR       Errno = 1227
+	ER_LOCAL_VARIABLE                     Errno = 1228
+	ER_GLOBAL_VARIABLE                    Errno = 1229
+	ER_NO_DEFAULT                         Errno = 1230
+	ER_WRONG_VALUE_FOR_VAR                Errno = 1231
+	ER_WRONG_TYPE_FOR_VAR                 Errno = 1232
+	ER_VAR_CANT_BE_READ                   Errno = 1233
+	ER_CANT_USE_OPTION_HERE               Errno = 1234
+	ER_NOT_SUPPORTED_YET                  Errno = 1235
+	ER_MASTER_FATAL_ERROR_READING_BINLOG  Errno = 1236
+	ER_SLAVE_IGNORED_TABLE                Errno = 1237
+	ER_INCORRECT_GLOBAL_LOCAL_VAR         Errno = 1238
+	ER_WRONG_FK_DEF                       Errno = 1239
+	ER_KEY_REF_DO_NOT_MATCH_TABLE_REF     Errno = 1240
+	ER_OPERAND_COLUMNS                    Errno = 1241
+	ER_SUBQUERY_NO_1_ROW                  Errno = 1242
+
+	ER_OPTION_PREVENTS_STATEMENT             Errno = 1290
+	ER_QUERY_INTERRUPTED                     Errno = 1317
+	ER_NO_DEFAULT_FOR_FIELD                  Errno = 1364
+	ER_DIVISION_BY_ZERO                      Errno = 1365
+	ER_TRUNCATED_WRONG_VALUE_FOR_FIELD       Errno = 1366
+	ER_XAER_NOTA                             Errno = 1397
+	ER_XAER_INVAL                            Errno = 1398
+	ER_XAER_RMFAIL                           Errno = 1399
+	ER_XAER_OUTSIDE                          Errno = 1400
+	ER_XAER_RMERR                            Errno = 1401
+	ER_XA_RBROLLBACK                         Errno = 1402
+	ER_DATA_TOO_LONG                         Errno = 1406
+	ER_XAER_DUPID                            Errno = 1440
+	ER_ROW_IS_REFERENCED_2                   Errno = 1451
+	ER_NO_REFERENCED_ROW_2                   Errno = 1452
+	ER_XA_RBTIMEOUT                          Errno = 1613
+	ER_XA_RBDEADLOCK                         Errno = 1614
+	ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION Errno = 1792
+)
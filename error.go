@@ -5,7 +5,10 @@
 // license that can be found in the LICENSE file.
 package mysql
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
 // Client error types
 type Errno int
@@ -110,26 +113,158 @@ const (
 	CR_ALREADY_CONNECTED_STR       Error = "This handle is already connected"
 	CR_AUTH_PLUGIN_CANNOT_LOAD     Errno = 2059
 	CR_AUTH_PLUGIN_CANNOT_LOAD_STR Error = "Authentication plugin '%s' cannot be loaded: %s"
+
+	// Client library specific errors
+	CR_RESULT_ROW_LIMIT            Errno = 2100
+	CR_RESULT_ROW_LIMIT_STR        Error = "Result set exceeds the limit of %d stored rows"
+	CR_RESULT_SIZE_LIMIT           Errno = 2101
+	CR_RESULT_SIZE_LIMIT_STR       Error = "Result set exceeds the limit of %d stored bytes"
+	CR_RESULT_SPILL_ERROR          Errno = 2102
+	CR_RESULT_SPILL_ERROR_STR      Error = "Error using temporary file for stored result: %s"
+	CR_TRANSACTION_IN_PROGRESS     Errno = 2103
+	CR_TRANSACTION_IN_PROGRESS_STR Error = "A transaction is already in progress"
+	CR_TRANSACTION_DONE            Errno = 2104
+	CR_TRANSACTION_DONE_STR        Error = "Transaction has already been committed or rolled back"
+	CR_TRANSACTION_IMPLICIT        Errno = 2105
+	CR_TRANSACTION_IMPLICIT_STR    Error = "Transaction was implicitly committed by the server"
+	CR_TRANSACTION_ROLLED_BACK     Errno = 2106
+	CR_TRANSACTION_ROLLED_BACK_STR Error = "Transaction was rolled back by the server or a lost connection"
+	CR_TRANSACTION_UNKNOWN         Errno = 2107
+	CR_TRANSACTION_UNKNOWN_STR     Error = "Connection lost during commit, the transaction may not have been committed"
+	CR_TRANSACTION_LOST            Errno = 2108
+	CR_TRANSACTION_LOST_STR        Error = "Connection reset, transaction lost"
+	CR_COMMAND_NOT_REPLAYED        Errno = 2109
+	CR_COMMAND_NOT_REPLAYED_STR    Error = "Connection reset, command not replayed as it may have been applied"
+	CR_RECONNECT_CANCELLED         Errno = 2110
+	CR_RECONNECT_CANCELLED_STR     Error = "Reconnect cancelled"
+	CR_LOCK_TIMEOUT                Errno = 2111
+	CR_LOCK_TIMEOUT_STR            Error = "Timeout waiting for client lock held by %s, possible deadlock"
+	CR_COMMAND_CANCELLED           Errno = 2112
+	CR_COMMAND_CANCELLED_STR       Error = "Command cancelled"
+	CR_INVALID_VARIABLE_NAME       Errno = 2113
+	CR_INVALID_VARIABLE_NAME_STR   Error = "Invalid variable name '%s'"
+	CR_LOCK_DEADLOCK               Errno = 2114
+	CR_LOCK_DEADLOCK_STR           Error = "Deadlock, %s while the same goroutine holds the client lock for %s"
+	CR_ASYNC_LOCKING_REQUIRED      Errno = 2115
+	CR_ASYNC_LOCKING_REQUIRED_STR  Error = "Client.Locking must be enabled for asynchronous commands"
 )
 
-// Client error struct
+// Client error struct, Cause is the underlying error if any e.g. a network error
 type ClientError struct {
 	Errno Errno
 	Error Error
+	Cause os.Error
 }
 
 // Convert to string
 func (e *ClientError) String() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("#%d %s: %s", e.Errno, e.Error, e.Cause)
+	}
 	return fmt.Sprintf("#%d %s", e.Errno, e.Error)
 }
 
-// Server error struct
+// Get the underlying error
+func (e *ClientError) Unwrap() os.Error {
+	return e.Cause
+}
+
+// Check if the error matches target, client errors match by number
+func (e *ClientError) Is(target os.Error) bool {
+	t, ok := target.(*ClientError)
+	return ok && t.Errno == e.Errno
+}
+
+// Server error struct, SQLState is only set for 4.1+ servers and Query is set
+// if the error was returned by Client.Query or Client.Prepare
 type ServerError struct {
-	Errno Errno
-	Error Error
+	Errno    Errno
+	Error    Error
+	SQLState string
+	Query    string
 }
 
 // Convert to string
 func (e *ServerError) String() string {
+	if e.SQLState != "" {
+		return fmt.Sprintf("#%d (%s) %s", e.Errno, e.SQLState, e.Error)
+	}
 	return fmt.Sprintf("#%d %s", e.Errno, e.Error)
 }
+
+// Check if the error matches target, server errors match by number
+func (e *ServerError) Is(target os.Error) bool {
+	t, ok := target.(*ServerError)
+	return ok && t.Errno == e.Errno
+}
+
+// Sentinel errors for use with IsError
+var (
+	ErrServerGone         = &ClientError{CR_SERVER_GONE_ERROR, CR_SERVER_GONE_ERROR_STR, nil}
+	ErrServerLost         = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, nil}
+	ErrCommandsOutOfSync  = &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	ErrMalformedPacket    = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
+	ErrNoResultSet        = &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	ErrDupEntry           = &ServerError{Errno: ER_DUP_ENTRY}
+	ErrLockDeadlock       = &ServerError{Errno: ER_LOCK_DEADLOCK}
+	ErrLockWaitTimeout    = &ServerError{Errno: ER_LOCK_WAIT_TIMEOUT}
+	ErrNoSuchTable        = &ServerError{Errno: ER_NO_SUCH_TABLE}
+	ErrAccessDenied       = &ServerError{Errno: ER_ACCESS_DENIED_ERROR}
+	ErrTooManyConnections = &ServerError{Errno: ER_CON_COUNT_ERROR}
+)
+
+// Wrapper interface, implemented by errors with an underlying cause
+type Wrapper interface {
+	Unwrap() os.Error
+}
+
+// Check if err or any error it wraps matches target, errors with an Is method
+// (such as ClientError and ServerError) are compared using it
+func IsError(err, target os.Error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		if m, ok := err.(interface {
+			Is(os.Error) bool
+		}); ok && m.Is(target) {
+			return true
+		}
+		w, ok := err.(Wrapper)
+		if !ok {
+			return false
+		}
+		err = w.Unwrap()
+	}
+	return false
+}
+
+// Get the server error from err or any error it wraps
+func AsServerError(err os.Error) (*ServerError, bool) {
+	for err != nil {
+		if e, ok := err.(*ServerError); ok {
+			return e, true
+		}
+		w, ok := err.(Wrapper)
+		if !ok {
+			break
+		}
+		err = w.Unwrap()
+	}
+	return nil, false
+}
+
+// Get the client error from err or any error it wraps
+func AsClientError(err os.Error) (*ClientError, bool) {
+	for err != nil {
+		if e, ok := err.(*ClientError); ok {
+			return e, true
+		}
+		w, ok := err.(Wrapper)
+		if !ok {
+			break
+		}
+		err = w.Unwrap()
+	}
+	return nil, false
+}
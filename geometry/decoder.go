@@ -0,0 +1,166 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package geometry
+
+import (
+	"math"
+	"os"
+)
+
+// WKB decoder struct
+type decoder struct {
+	data []byte
+	pos  int
+	big  bool
+}
+
+// Read a complete geometry including header
+func (d *decoder) geometry() (g Geometry, err os.Error) {
+	// Recover errors
+	defer func() {
+		if e := recover(); e != nil {
+			if dErr, ok := e.(os.Error); ok {
+				err = dErr
+			} else {
+				err = ErrShortData
+			}
+		}
+	}()
+	return d.read(), nil
+}
+
+// Read a geometry, panics on error
+func (d *decoder) read() Geometry {
+	switch d.header() {
+	case TYPE_POINT:
+		return d.point()
+	case TYPE_LINESTRING:
+		return d.lineString()
+	case TYPE_POLYGON:
+		return d.polygon()
+	case TYPE_MULTIPOINT:
+		n := d.count(21)
+		m := make(MultiPoint, n)
+		for i := range m {
+			d.expect(TYPE_POINT)
+			m[i] = d.point()
+		}
+		return m
+	case TYPE_MULTILINESTRING:
+		n := d.count(9)
+		m := make(MultiLineString, n)
+		for i := range m {
+			d.expect(TYPE_LINESTRING)
+			m[i] = d.lineString()
+		}
+		return m
+	case TYPE_MULTIPOLYGON:
+		n := d.count(9)
+		m := make(MultiPolygon, n)
+		for i := range m {
+			d.expect(TYPE_POLYGON)
+			m[i] = d.polygon()
+		}
+		return m
+	case TYPE_GEOMETRYCOLLECTION:
+		n := d.count(5)
+		c := make(GeometryCollection, n)
+		for i := range c {
+			c[i] = d.read()
+		}
+		return c
+	}
+	panic(ErrUnknownType)
+}
+
+// Read byte order and type
+func (d *decoder) header() Type {
+	switch d.next(1)[0] {
+	case WKB_XDR:
+		d.big = true
+	case WKB_NDR:
+		d.big = false
+	default:
+		panic(ErrByteOrder)
+	}
+	return Type(d.uint32())
+}
+
+// Read a header and check the type, used for members of multi geometries
+func (d *decoder) expect(t Type) {
+	if d.header() != t {
+		panic(ErrTypeInMulti)
+	}
+}
+
+// Read point data
+func (d *decoder) point() Point {
+	return Point{d.float64(), d.float64()}
+}
+
+// Read line string data
+func (d *decoder) lineString() LineString {
+	n := d.count(16)
+	l := make(LineString, n)
+	for i := range l {
+		l[i] = d.point()
+	}
+	return l
+}
+
+// Read polygon data
+func (d *decoder) polygon() Polygon {
+	n := d.count(4)
+	p := make(Polygon, n)
+	for i := range p {
+		p[i] = d.lineString()
+	}
+	return p
+}
+
+// Read an element count, checking there is enough data for the elements
+func (d *decoder) count(size int) int {
+	n := int(d.uint32())
+	if n < 0 || n > (len(d.data)-d.pos)/size {
+		panic(ErrShortData)
+	}
+	return n
+}
+
+// Read uint32 in current byte order
+func (d *decoder) uint32() (n uint32) {
+	b := d.next(4)
+	if d.big {
+		n = uint32(b[3]) | uint32(b[2])<<8 | uint32(b[1])<<16 | uint32(b[0])<<24
+	} else {
+		n = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	}
+	return
+}
+
+// Read float64 in current byte order
+func (d *decoder) float64() float64 {
+	b := d.next(8)
+	var n uint64
+	for i := uint(0); i < 8; i++ {
+		if d.big {
+			n |= uint64(b[7-i]) << (i * 8)
+		} else {
+			n |= uint64(b[i]) << (i * 8)
+		}
+	}
+	return math.Float64frombits(n)
+}
+
+// Get the next n bytes, the data may share a larger array so check length
+func (d *decoder) next(n int) (b []byte) {
+	if len(d.data)-d.pos < n {
+		panic(ErrShortData)
+	}
+	b = d.data[d.pos : d.pos+n]
+	d.pos += n
+	return
+}
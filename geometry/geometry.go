@@ -0,0 +1,333 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Spatial types for MySQL GEOMETRY columns.
+//
+// MySQL stores spatial values in an internal format consisting of a 4 byte
+// SRID followed by the OpenGIS Well-Known Binary (WKB) representation of the
+// geometry. This package reads and writes that format.
+package geometry
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strconv"
+)
+
+// WKB byte orders
+const (
+	WKB_XDR = 0x0 // Big endian
+	WKB_NDR = 0x1 // Little endian
+)
+
+// WKB geometry type
+type Type uint32
+
+const (
+	TYPE_POINT Type = iota + 1
+	TYPE_LINESTRING
+	TYPE_POLYGON
+	TYPE_MULTIPOINT
+	TYPE_MULTILINESTRING
+	TYPE_MULTIPOLYGON
+	TYPE_GEOMETRYCOLLECTION
+)
+
+// Errors
+var (
+	ErrShortData   = os.NewError("geometry: data too short")
+	ErrByteOrder   = os.NewError("geometry: invalid byte order")
+	ErrUnknownType = os.NewError("geometry: unknown geometry type")
+	ErrTypeInMulti = os.NewError("geometry: invalid geometry type in collection")
+	ErrTrailing    = os.NewError("geometry: trailing data after geometry")
+)
+
+// Geometry interface, implemented by all spatial types
+type Geometry interface {
+	Type() Type
+	WKT() string
+	writeWKB(b *bytes.Buffer)
+}
+
+// Point
+type Point struct {
+	X, Y float64
+}
+
+// LineString, a sequence of points
+type LineString []Point
+
+// Polygon, the first ring is the exterior ring, any others are holes
+type Polygon []LineString
+
+// MultiPoint
+type MultiPoint []Point
+
+// MultiLineString
+type MultiLineString []LineString
+
+// MultiPolygon
+type MultiPolygon []Polygon
+
+// GeometryCollection
+type GeometryCollection []Geometry
+
+// A geometry value with spatial reference id, as stored by MySQL
+type Value struct {
+	SRID     uint32
+	Geometry Geometry
+}
+
+// Decode a value from the MySQL internal format (SRID + WKB)
+func Decode(data []byte) (v *Value, err os.Error) {
+	if len(data) < 4 {
+		return nil, ErrShortData
+	}
+	g, err := DecodeWKB(data[4:])
+	if err != nil {
+		return
+	}
+	v = &Value{
+		SRID:     uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24,
+		Geometry: g,
+	}
+	return
+}
+
+// Encode a value into the MySQL internal format (SRID + WKB)
+func (v *Value) Encode() []byte {
+	b := new(bytes.Buffer)
+	writeUint32(b, v.SRID)
+	v.Geometry.writeWKB(b)
+	return b.Bytes()
+}
+
+// Get value as WKT, the SRID is not included
+func (v *Value) String() string {
+	return v.Geometry.WKT()
+}
+
+// Decode a geometry from WKB
+func DecodeWKB(data []byte) (g Geometry, err os.Error) {
+	d := &decoder{data: data}
+	g, err = d.geometry()
+	if err != nil {
+		return
+	}
+	if d.pos != len(d.data) {
+		return nil, ErrTrailing
+	}
+	return
+}
+
+// Encode a geometry as WKB (little endian)
+func EncodeWKB(g Geometry) []byte {
+	b := new(bytes.Buffer)
+	g.writeWKB(b)
+	return b.Bytes()
+}
+
+// Point type
+func (p Point) Type() Type {
+	return TYPE_POINT
+}
+
+// Point as WKT
+func (p Point) WKT() string {
+	return "POINT(" + p.coords() + ")"
+}
+
+// Point as WKB
+func (p Point) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_POINT)
+	writeFloat64(b, p.X)
+	writeFloat64(b, p.Y)
+}
+
+// Point coordinates
+func (p Point) coords() string {
+	return strconv.Ftoa64(p.X, 'g', -1) + " " + strconv.Ftoa64(p.Y, 'g', -1)
+}
+
+// LineString type
+func (l LineString) Type() Type {
+	return TYPE_LINESTRING
+}
+
+// LineString as WKT
+func (l LineString) WKT() string {
+	return "LINESTRING" + l.coords()
+}
+
+// LineString as WKB
+func (l LineString) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_LINESTRING)
+	l.writePoints(b)
+}
+
+// LineString coordinates
+func (l LineString) coords() string {
+	s := make([]string, len(l))
+	for i, p := range l {
+		s[i] = p.coords()
+	}
+	return wrap(s)
+}
+
+// LineString points, without header
+func (l LineString) writePoints(b *bytes.Buffer) {
+	writeUint32(b, uint32(len(l)))
+	for _, p := range l {
+		writeFloat64(b, p.X)
+		writeFloat64(b, p.Y)
+	}
+}
+
+// Polygon type
+func (p Polygon) Type() Type {
+	return TYPE_POLYGON
+}
+
+// Polygon as WKT
+func (p Polygon) WKT() string {
+	return "POLYGON" + p.coords()
+}
+
+// Polygon as WKB
+func (p Polygon) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_POLYGON)
+	writeUint32(b, uint32(len(p)))
+	for _, r := range p {
+		r.writePoints(b)
+	}
+}
+
+// Polygon coordinates
+func (p Polygon) coords() string {
+	s := make([]string, len(p))
+	for i, r := range p {
+		s[i] = r.coords()
+	}
+	return wrap(s)
+}
+
+// MultiPoint type
+func (m MultiPoint) Type() Type {
+	return TYPE_MULTIPOINT
+}
+
+// MultiPoint as WKT
+func (m MultiPoint) WKT() string {
+	return "MULTIPOINT" + LineString(m).coords()
+}
+
+// MultiPoint as WKB
+func (m MultiPoint) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_MULTIPOINT)
+	writeUint32(b, uint32(len(m)))
+	for _, p := range m {
+		p.writeWKB(b)
+	}
+}
+
+// MultiLineString type
+func (m MultiLineString) Type() Type {
+	return TYPE_MULTILINESTRING
+}
+
+// MultiLineString as WKT
+func (m MultiLineString) WKT() string {
+	return "MULTILINESTRING" + Polygon(m).coords()
+}
+
+// MultiLineString as WKB
+func (m MultiLineString) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_MULTILINESTRING)
+	writeUint32(b, uint32(len(m)))
+	for _, l := range m {
+		l.writeWKB(b)
+	}
+}
+
+// MultiPolygon type
+func (m MultiPolygon) Type() Type {
+	return TYPE_MULTIPOLYGON
+}
+
+// MultiPolygon as WKT
+func (m MultiPolygon) WKT() string {
+	s := make([]string, len(m))
+	for i, p := range m {
+		s[i] = p.coords()
+	}
+	return "MULTIPOLYGON" + wrap(s)
+}
+
+// MultiPolygon as WKB
+func (m MultiPolygon) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_MULTIPOLYGON)
+	writeUint32(b, uint32(len(m)))
+	for _, p := range m {
+		p.writeWKB(b)
+	}
+}
+
+// GeometryCollection type
+func (c GeometryCollection) Type() Type {
+	return TYPE_GEOMETRYCOLLECTION
+}
+
+// GeometryCollection as WKT
+func (c GeometryCollection) WKT() string {
+	s := make([]string, len(c))
+	for i, g := range c {
+		s[i] = g.WKT()
+	}
+	return "GEOMETRYCOLLECTION" + wrap(s)
+}
+
+// GeometryCollection as WKB
+func (c GeometryCollection) writeWKB(b *bytes.Buffer) {
+	writeHeader(b, TYPE_GEOMETRYCOLLECTION)
+	writeUint32(b, uint32(len(c)))
+	for _, g := range c {
+		g.writeWKB(b)
+	}
+}
+
+// Join WKT parts and wrap in brackets
+func wrap(s []string) string {
+	b := new(bytes.Buffer)
+	b.WriteByte('(')
+	for i, v := range s {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(v)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// Write a WKB header, always little endian
+func writeHeader(b *bytes.Buffer, t Type) {
+	b.WriteByte(WKB_NDR)
+	writeUint32(b, uint32(t))
+}
+
+// Write a little endian uint32
+func writeUint32(b *bytes.Buffer, n uint32) {
+	b.Write([]byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)})
+}
+
+// Write a little endian float64
+func writeFloat64(b *bytes.Buffer, f float64) {
+	n := math.Float64bits(f)
+	for i := uint(0); i < 8; i++ {
+		b.WriteByte(byte(n >> (i * 8)))
+	}
+}
@@ -0,0 +1,104 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package geometry
+
+import (
+	"bytes"
+	"testing"
+)
+
+// MySQL internal format for SRID 4326 POINT(1 2), from SELECT GeomFromText('POINT(1 2)', 4326)
+var pointData = []byte{
+	0xe6, 0x10, 0x00, 0x00,
+	0x01, 0x01, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40,
+}
+
+// Geometries for WKB round trip and WKT tests
+var wktTests = []struct {
+	g   Geometry
+	wkt string
+}{
+	{Point{1, 2}, "POINT(1 2)"},
+	{LineString{{0, 0}, {1, 1}, {2.5, -3}}, "LINESTRING(0 0,1 1,2.5 -3)"},
+	{Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}}, "POLYGON((0 0,4 0,4 4,0 0),(1 1,2 1,2 2,1 1))"},
+	{MultiPoint{{1, 1}, {2, 2}}, "MULTIPOINT(1 1,2 2)"},
+	{MultiLineString{{{0, 0}, {1, 1}}, {{2, 2}, {3, 3}}}, "MULTILINESTRING((0 0,1 1),(2 2,3 3))"},
+	{MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}}, "MULTIPOLYGON(((0 0,1 0,1 1,0 0)),((5 5,6 5,6 6,5 5)))"},
+	{GeometryCollection{Point{1, 2}, LineString{{0, 0}, {1, 1}}}, "GEOMETRYCOLLECTION(POINT(1 2),LINESTRING(0 0,1 1))"},
+}
+
+// Test decoding of the MySQL internal format
+func TestDecode(t *testing.T) {
+	v, err := Decode(pointData)
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	if v.SRID != 4326 {
+		t.Errorf("Expected SRID 4326 but got %d", v.SRID)
+	}
+	if p, ok := v.Geometry.(Point); !ok || p.X != 1 || p.Y != 2 {
+		t.Errorf("Expected POINT(1 2) but got %#v", v.Geometry)
+	}
+	if !bytes.Equal(v.Encode(), pointData) {
+		t.Errorf("Encoded value doesn't match original data")
+	}
+}
+
+// Test big endian WKB input
+func TestDecodeBigEndian(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x01,
+		0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	g, err := DecodeWKB(data)
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	if g.WKT() != "POINT(1 2)" {
+		t.Errorf("Expected POINT(1 2) but got %s", g.WKT())
+	}
+}
+
+// Test WKT output and WKB round trip for all types
+func TestRoundTrip(t *testing.T) {
+	for _, test := range wktTests {
+		if wkt := test.g.WKT(); wkt != test.wkt {
+			t.Errorf("Expected %s but got %s", test.wkt, wkt)
+		}
+		v := &Value{SRID: 27700, Geometry: test.g}
+		d, err := Decode(v.Encode())
+		if err != nil {
+			t.Errorf("Error %s decoding %s", err, test.wkt)
+			continue
+		}
+		if d.SRID != v.SRID || d.String() != test.wkt {
+			t.Errorf("Round trip of %s returned SRID %d %s", test.wkt, d.SRID, d)
+		}
+	}
+}
+
+// Test malformed data returns errors rather than panicking
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		data []byte
+		err  interface{}
+	}{
+		{pointData[:3], ErrShortData},
+		{pointData[:20], ErrShortData},
+		{append(append([]byte{}, pointData...), 0x0), ErrTrailing},
+		{[]byte{0x0, 0x0, 0x0, 0x0, 0x02, 0x01, 0x0, 0x0, 0x0}, ErrByteOrder},
+		{[]byte{0x0, 0x0, 0x0, 0x0, 0x01, 0x09, 0x0, 0x0, 0x0}, ErrUnknownType},
+		{[]byte{0x0, 0x0, 0x0, 0x0, 0x01, 0x02, 0x0, 0x0, 0x0, 0xff, 0xff, 0xff, 0x0f}, ErrShortData},
+	}
+	for i, test := range tests {
+		if _, err := Decode(test.data); err != test.err {
+			t.Errorf("Test %d expected error %v but got %v", i, test.err, err)
+		}
+	}
+}
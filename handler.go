@@ -23,7 +23,12 @@ func handleOK(p *packetOK, c *Client, a, i *uint64, w *uint16) (err os.Error) {
 	*a = p.affectedRows
 	*i = p.insertId
 	*w = p.warningCount
-	c.serverStatus = ServerStatus(p.serverStatus)
+	c.setStatus(ServerStatus(p.serverStatus))
+	// Current database changed
+	if p.schemaChanged {
+		c.log(1, "Current database changed to '%s'", p.schema)
+		c.dbname = p.schema
+	}
 	// Full logging [level 3]
 	if c.LogLevel > 2 {
 		c.logStatus()
@@ -45,8 +50,13 @@ func handleError(p *packetError, c *Client) (err os.Error) {
 	if c.MoreResults() {
 		c.serverStatus ^= SERVER_MORE_RESULTS_EXISTS
 	}
+	// The server rolls back the transaction on deadlock
+	if Errno(p.errno) == ER_LOCK_DEADLOCK && c.serverStatus&SERVER_STATUS_IN_TRANS > 0 {
+		c.serverStatus &^= SERVER_STATUS_IN_TRANS
+		c.abortTx()
+	}
 	// Return error
-	return &ServerError{Errno(p.errno), Error(p.error)}
+	return &ServerError{Errno(p.errno), Error(p.error), p.state, ""}
 }
 
 // EOF packet handler
@@ -60,7 +70,7 @@ func handleEOF(p *packetEOF, c *Client) (err os.Error) {
 	}
 	// Store packet data
 	if p.useStatus {
-		c.serverStatus = ServerStatus(p.serverStatus)
+		c.setStatus(ServerStatus(p.serverStatus))
 		// Full logging [level 3]
 		if c.LogLevel > 2 {
 			c.logStatus()
@@ -98,13 +108,19 @@ func handleField(p *packetField, c *Client, r *Result) (err os.Error) {
 	}
 	// Apppend new field
 	r.fields = append(r.fields, &Field{
-		Database: p.database,
-		Table:    p.table,
-		Name:     p.name,
-		Length:   p.length,
-		Type:     FieldType(p.fieldType),
-		Flags:    FieldFlag(p.flags),
-		Decimals: p.decimals,
+		Catalog:    p.catalog,
+		Database:   p.database,
+		Table:      p.table,
+		OrgTable:   p.orgTable,
+		Name:       p.name,
+		OrgName:    p.orgName,
+		Charset:    p.charsetNumber,
+		Length:     p.length,
+		Type:       FieldType(p.fieldType),
+		Flags:      FieldFlag(p.flags),
+		Decimals:   p.decimals,
+		Default:    string(p.defaultVal),
+		HasDefault: p.hasDefault,
 	})
 	return
 }
@@ -128,7 +144,7 @@ func handleRow(p *packetRowData, c *Client, r *Result) (err os.Error) {
 	// Iterate fields to get types
 	for i, f := range r.fields {
 		// Check null
-		if len(p.row[i].([]byte)) ==0 {
+		if p.row[i] == nil {
 			field = nil
 		} else {
 			switch f.Type {
@@ -148,9 +164,13 @@ func handleRow(p *packetRowData, c *Client, r *Result) (err os.Error) {
 				if err != nil {
 					return
 				}
-			// Strings
-			case FIELD_TYPE_DECIMAL, FIELD_TYPE_NEWDECIMAL, FIELD_TYPE_VARCHAR, FIELD_TYPE_VAR_STRING, FIELD_TYPE_STRING:
+			// Decimals
+			case FIELD_TYPE_DECIMAL, FIELD_TYPE_NEWDECIMAL:
 				field = string(p.row[i].([]byte))
+			// Strings, text and blobs
+			case FIELD_TYPE_VARCHAR, FIELD_TYPE_VAR_STRING, FIELD_TYPE_STRING,
+				FIELD_TYPE_TINY_BLOB, FIELD_TYPE_MEDIUM_BLOB, FIELD_TYPE_LONG_BLOB, FIELD_TYPE_BLOB:
+				field = textValue(f, p.row[i].([]byte))
 			// Anything else
 			default:
 				field = p.row[i]
@@ -161,8 +181,8 @@ func handleRow(p *packetRowData, c *Client, r *Result) (err os.Error) {
 	}
 	// Stored result
 	if r.mode == RESULT_STORED {
-		// Cast and append the row
-		r.rows = append(r.rows, Row(row))
+		// Cast and store the row
+		r.storeRow(Row(row))
 	}
 	// Used result
 	if r.mode == RESULT_USED {
@@ -190,7 +210,7 @@ func handlePrepareOK(p *packetPrepareOK, c *Client, s *Statement) (err os.Error)
 }
 
 // Parameter packet handler
-func handleParam(p *packetParameter, c *Client) (err os.Error) {
+func handleParam(p *packetParameter, c *Client, s *Statement) (err os.Error) {
 	// Log result
 	c.log(1, "[%d] Received parameter packet", p.sequence)
 	// Check sequence
@@ -198,7 +218,13 @@ func handleParam(p *packetParameter, c *Client) (err os.Error) {
 	if err != nil {
 		return
 	}
-	// @todo at some point implement this properly if any versions of MySQL are doing so
+	// Append new param
+	s.params = append(s.params, &Param{
+		Type:     FieldType(p.paramType),
+		Flags:    FieldFlag(p.flags),
+		Length:   p.length,
+		Decimals: p.decimals,
+	})
 	return
 }
 
@@ -227,7 +253,7 @@ func handleBinaryRow(p *packetRowBinary, c *Client, r *Result) (err os.Error) {
 		posByte := (i + 2) / 8
 		posBit := i - (posByte * 8) + 2
 		if nbm[posByte]&(1<<uint8(posBit)) != 0 {
-			field = nil
+			row = append(row, nil)
 			continue
 		}
 		// Otherwise use field type
@@ -280,7 +306,16 @@ func handleBinaryRow(p *packetRowBinary, c *Client, r *Result) (err os.Error) {
 			if err != nil {
 				return
 			}
-			field = p.data[pos+uint64(n) : pos+uint64(n)+num]
+			b := p.data[pos+uint64(n) : pos+uint64(n)+num]
+			switch f.Type {
+			// Bit and spatial values are always bytes
+			case FIELD_TYPE_BIT, FIELD_TYPE_GEOMETRY:
+				field = b
+			case FIELD_TYPE_DECIMAL, FIELD_TYPE_NEWDECIMAL:
+				field = string(b)
+			default:
+				field = textValue(f, b)
+			}
 			pos += uint64(n) + num
 		// Date (From libmysql/libmysql.c read_binary_datetime)
 		case FIELD_TYPE_DATE:
@@ -360,8 +395,8 @@ func handleBinaryRow(p *packetRowBinary, c *Client, r *Result) (err os.Error) {
 	}
 	// Stored result
 	if r.mode == RESULT_STORED {
-		// Cast and append the row
-		r.rows = append(r.rows, Row(row))
+		// Cast and store the row
+		r.storeRow(Row(row))
 	}
 	// Used result
 	if r.mode == RESULT_USED {
@@ -370,3 +405,12 @@ func handleBinaryRow(p *packetRowBinary, c *Client, r *Result) (err os.Error) {
 	}
 	return
 }
+
+// Get the value of a string or blob column, binary data is kept as bytes and
+// text is converted to a UTF-8 string
+func textValue(f *Field, b []byte) interface{} {
+	if f.IsBinary() {
+		return b
+	}
+	return string(decodeCharset(f.Charset, b))
+}
@@ -0,0 +1,165 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Lock token for an operation such as a query, results from a query keep
+// the token so can be read and freed while the query holds the lock
+type lockToken struct {
+	desc string
+}
+
+// Acquire the client lock for a new operation (e.g. a query) with a new token
+func (c *Client) acquireNew(desc string) os.Error {
+	return c.acquire(&lockToken{desc}, desc)
+}
+
+// Acquire the client lock for owner when Locking is enabled. The lock is
+// passed through if owner already holds it, a nil owner continues the
+// operation held by the calling goroutine (e.g. Client.FreeResult). Other
+// owners wait for the lock unless the calling goroutine holds it, which
+// would never be released so CR_LOCK_DEADLOCK is returned immediately.
+// Detection is best effort as it relies on the goroutine id from the stack
+// trace, if the id is unknown a nil owner continues the operation holding the
+// lock and other owners wait until the lock timeout
+func (c *Client) acquire(owner interface{}, desc string) os.Error {
+	if !c.Locking {
+		return nil
+	}
+	id := goroutineId()
+	c.lockMutex.Lock()
+	if c.lockChan == nil {
+		c.lockChan = make(chan bool, 1)
+	}
+	if id == 0 && !c.lockNoId {
+		c.lockNoId = true
+		c.log(1, "!!! Unable to get goroutine id, lock deadlock detection disabled !!!")
+	}
+	if c.lockOwner != nil {
+		// Owner already holds the lock
+		if owner != nil && owner == c.lockOwner {
+			c.lockMutex.Unlock()
+			return nil
+		}
+		// Lock held by the calling goroutine
+		if id == 0 && owner == nil || id != 0 && id == c.lockGoroutine {
+			if owner == nil {
+				c.lockMutex.Unlock()
+				return nil
+			}
+			held := c.lockDesc
+			c.lockMutex.Unlock()
+			c.log(1, "!!! Client lock already held by this goroutine !!!")
+			return &ClientError{CR_LOCK_DEADLOCK, c.fmtError(CR_LOCK_DEADLOCK_STR, desc, held), nil}
+		}
+	}
+	ch := c.lockChan
+	c.lockMutex.Unlock()
+	// Wait for the lock
+	timeout := c.LockTimeout
+	if timeout == 0 {
+		timeout = DEFAULT_LOCK_TIMEOUT
+	}
+	if timeout < 0 {
+		ch <- true
+	} else {
+		select {
+		case ch <- true:
+		case <-time.After(timeout):
+			c.lockMutex.Lock()
+			held := c.lockDesc
+			c.lockMutex.Unlock()
+			c.log(1, "!!! Timeout waiting for client lock !!!")
+			return &ClientError{CR_LOCK_TIMEOUT, c.fmtError(CR_LOCK_TIMEOUT_STR, held), nil}
+		}
+	}
+	// Set owner
+	if owner == nil {
+		owner = &lockToken{desc}
+	}
+	c.lockMutex.Lock()
+	c.lockOwner = owner
+	c.lockGoroutine = id
+	c.lockDesc = desc
+	c.lockMutex.Unlock()
+	return nil
+}
+
+// Release the client lock if held by owner, a nil owner releases the lock
+// whoever holds it
+func (c *Client) release(owner interface{}) {
+	if !c.Locking {
+		return
+	}
+	c.lockMutex.Lock()
+	defer c.lockMutex.Unlock()
+	if c.lockOwner == nil || (owner != nil && c.lockOwner != owner) {
+		return
+	}
+	c.lockOwner = nil
+	c.lockGoroutine = 0
+	c.lockDesc = ""
+	<-c.lockChan
+}
+
+// Release the lock after a client operation, the lock is kept until the
+// result and any further results have been read and freed. Locks held by a
+// statement are kept until the statement is closed
+func (c *Client) unlock() {
+	if !c.Locking || c.result != nil || c.stream != nil || c.MoreResults() {
+		return
+	}
+	c.lockMutex.Lock()
+	owner := c.lockOwner
+	c.lockMutex.Unlock()
+	if _, ok := owner.(*lockToken); ok {
+		c.release(owner)
+	}
+}
+
+// Get the owner currently holding the lock, new results keep the owner
+func (c *Client) lockHolder() interface{} {
+	if !c.Locking {
+		return nil
+	}
+	c.lockMutex.Lock()
+	defer c.lockMutex.Unlock()
+	return c.lockOwner
+}
+
+// Acquire the client lock for a prepared statement, the lock is kept until
+// the statement is closed. Statements that are not prepared return an error
+// without locking
+func (s *Statement) lock() os.Error {
+	if !s.prepared {
+		return nil
+	}
+	return s.c.acquire(s, "statement '"+s.preparedSql+"'")
+}
+
+// Get the id of the calling goroutine from the stack trace header
+// "goroutine N [...]", 0 if unknown
+func goroutineId() (id int64) {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	prefix := []byte("goroutine ")
+	if !bytes.HasPrefix(b, prefix) {
+		return 0
+	}
+	for _, ch := range b[len(prefix):] {
+		if ch < '0' || ch > '9' {
+			break
+		}
+		id = id*10 + int64(ch-'0')
+	}
+	return
+}
@@ -29,6 +29,9 @@ const (
 	PROTOCOL_40      = 40
 	DEFAULT_PROTOCOL = PROTOCOL_41
 
+	// Internal locking
+	DEFAULT_LOCK_TIMEOUT = 30000000000
+
 	// Connection types
 	TCP  = "tcp"
 	UNIX = "unix"
@@ -68,6 +71,46 @@ type Client struct {
 	connected bool
 	Reconnect bool
 
+	// Charset or collation name to use for the connection, the server default is used if not set
+	Charset string
+
+	// Stored result limits, 0 for no limit
+	MaxStoreRows  uint64
+	MaxStoreBytes uint64
+
+	// Stored results larger than SpillBytes are written to a temporary file in SpillDir
+	SpillBytes uint64
+	SpillDir   string
+
+	// Retry policy for RunInTransaction, DefaultRetryPolicy is used if nil
+	RetryPolicy *RetryPolicy
+
+	// Reconnect policy for auto reconnect, DefaultReconnectPolicy is used if nil
+	ReconnectPolicy *ReconnectPolicy
+
+	// Idle connections are pinged before use after PingIdleTime and are
+	// reconnected after MaxIdleTime (nanoseconds, 0 to disable)
+	PingIdleTime int64
+	MaxIdleTime  int64
+	lastUsed     int64
+
+	// Internal locking, a query holds the lock until the result is freed and
+	// a statement until it is closed. LockTimeout is the maximum wait in
+	// nanoseconds, 0 for DEFAULT_LOCK_TIMEOUT or negative to wait forever
+	Locking       bool
+	LockTimeout   int64
+	lockMutex     sync.Mutex
+	lockChan      chan bool
+	lockOwner     interface{}
+	lockGoroutine int64
+	lockDesc      string
+	lockNoId      bool
+
+	// Asynchronous commands, run in order by a goroutine while queued
+	asyncMutex   sync.Mutex
+	asyncQueue   []func()
+	asyncRunning bool
+
 	// Sequence
 	protocol uint8
 	sequence uint8
@@ -77,6 +120,7 @@ type Client struct {
 	serverProtocol uint8
 	serverFlags    ClientFlag
 	serverCharset  uint8
+	collation      uint16
 	serverStatus   ServerStatus
 	scrambleBuff   []byte
 
@@ -85,6 +129,18 @@ type Client struct {
 	LastInsertId uint64
 	Warnings     uint16
 	result       *Result
+	stream       *columnStream
+
+	// Transaction started with Begin and XA transaction started with XAStart,
+	// the SQL of the last command is used to tell how a transaction ended
+	tx      *Tx
+	xid     *Xid
+	lastSql string
+
+	// Session state restored on reconnect
+	sessionVars []sessionVar
+	stmts       []*Statement
+	restoring   bool
 }
 
 // Create new client
@@ -128,8 +184,8 @@ func (c *Client) Connect(network, raddr, user, passwd string, dbname ...string)
 	// Log connect
 	c.log(1, "=== Begin connect ===")
 	// Check not already connected
-	if c.checkConn() {
-		return &ClientError{CR_ALREADY_CONNECTED, CR_ALREADY_CONNECTED_STR}
+	if c.connected {
+		return &ClientError{CR_ALREADY_CONNECTED, CR_ALREADY_CONNECTED_STR, nil}
 	}
 	// Reset client
 	c.reset()
@@ -153,11 +209,17 @@ func (c *Client) Connect(network, raddr, user, passwd string, dbname ...string)
 
 // Close connection to server
 func (c *Client) Close() (err os.Error) {
+	// Lock client
+	err = c.acquire(nil, "close")
+	if err != nil {
+		return
+	}
+	defer c.release(nil)
 	// Log close
 	c.log(1, "=== Begin close ===")
 	// Check connection
-	if !c.checkConn() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+	if !c.connected {
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Reset client
 	c.reset()
@@ -169,27 +231,36 @@ func (c *Client) Close() (err os.Error) {
 	c.log(1, "Disconnected")
 	// Set connected
 	c.connected = false
+	// Session state is not kept for a new connection
+	c.sessionVars = nil
+	c.stmts = nil
 	return
 }
 
 // Change the current database
 func (c *Client) ChangeDb(dbname string) (err os.Error) {
+	// Lock client
+	err = c.acquireNew("change db")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	return c.changeDb(dbname)
+}
+
+// Change the current database, the command is sent again on reconnect
+func (c *Client) changeDb(dbname string) (err os.Error) {
 	// Auto reconnect
 	defer func() {
-		if err != nil && c.checkNet(err) && c.Reconnect {
-			c.log(1, "!!! Lost connection to server !!!")
-			c.connected = false
-			err = c.reconnect()
-			if err == nil {
-				err = c.ChangeDb(dbname)
-			}
-		}
+		err = c.safeReconnect(err, true, func() os.Error {
+			return c.changeDb(dbname)
+		})
 	}()
 	// Log changeDb
 	c.log(1, "=== Begin change db to '%s' ===", dbname)
 	// Pre-run checks
 	if !c.checkConn() || c.checkResult() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Reset client
 	c.reset()
@@ -201,27 +272,52 @@ func (c *Client) ChangeDb(dbname string) (err os.Error) {
 	// Read result from server
 	c.sequence++
 	_, err = c.getResult(PACKET_OK | PACKET_ERROR)
+	if err != nil {
+		return
+	}
+	// Store for reconnect
+	c.dbname = dbname
 	return
 }
 
-// Send a query/queries to the server
+// Send a query/queries to the server, if the connection is lost only read
+// queries are run again after reconnecting
 func (c *Client) Query(sql string) (err os.Error) {
+	// Lock client until the result is freed
+	err = c.acquireNew("query '" + sql + "'")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	return c.query(sql, isReadQuery(sql))
+}
+
+// Send a query/queries to the server, the query is run again after
+// reconnecting if the connection is lost outside of a transaction so must be
+// safe to run twice
+func (c *Client) QueryIdempotent(sql string) (err os.Error) {
+	// Lock client until the result is freed
+	err = c.acquireNew("query '" + sql + "'")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	return c.query(sql, true)
+}
+
+// Send a query/queries to the server, safe queries are replayed on reconnect
+func (c *Client) query(sql string, safe bool) (err os.Error) {
 	// Auto reconnect
 	defer func() {
-		if err != nil && c.checkNet(err) && c.Reconnect {
-			c.log(1, "!!! Lost connection to server !!!")
-			c.connected = false
-			err = c.reconnect()
-			if err == nil {
-				err = c.Query(sql)
-			}
-		}
+		err = c.safeReconnect(err, safe, func() os.Error {
+			return c.query(sql, safe)
+		})
 	}()
 	// Log query
 	c.log(1, "=== Begin query '%s' ===", sql)
 	// Pre-run checks
 	if !c.checkConn() || c.checkResult() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Reset client
 	c.reset()
@@ -233,6 +329,9 @@ func (c *Client) Query(sql string) (err os.Error) {
 	// Read result from server
 	c.sequence++
 	_, err = c.getResult(PACKET_OK | PACKET_ERROR | PACKET_RESULT)
+	if sErr, ok := err.(*ServerError); ok {
+		sErr.Query = sql
+	}
 	if err != nil || c.result == nil {
 		return
 	}
@@ -241,8 +340,62 @@ func (c *Client) Query(sql string) (err os.Error) {
 	return
 }
 
+// Get the fields for a table, wild is an optional column name pattern
+func (c *Client) FieldList(table string, wild ...string) (fields []*Field, err os.Error) {
+	// Lock client
+	err = c.acquireNew("field list")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	// Auto reconnect
+	defer func() {
+		err = c.simpleReconnect(err)
+	}()
+	// Log field list
+	c.log(1, "=== Begin field list for '%s' ===", table)
+	// Pre-run checks
+	if !c.checkConn() || c.checkResult() {
+		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	// Reset client
+	c.reset()
+	// Send field list command
+	if len(wild) > 0 {
+		err = c.command(COM_FIELD_LIST, table, wild[0])
+	} else {
+		err = c.command(COM_FIELD_LIST, table)
+	}
+	if err != nil {
+		return
+	}
+	// Fields are read into a temporary result
+	c.result = &Result{c: c}
+	defer func() {
+		c.result = nil
+	}()
+	// Read fields till EOF is returned
+	for {
+		c.sequence++
+		eof, err := c.getResult(PACKET_FIELD | PACKET_EOF | PACKET_ERROR)
+		if err != nil {
+			return nil, err
+		}
+		if eof {
+			break
+		}
+	}
+	return c.result.fields, nil
+}
+
 // Fetch all rows for a result and store it, returning the result set
 func (c *Client) StoreResult() (result *Result, err os.Error) {
+	// Lock client
+	err = c.acquire(nil, "result")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
 	// Auto reconnect
 	defer func() {
 		err = c.simpleReconnect(err)
@@ -251,11 +404,11 @@ func (c *Client) StoreResult() (result *Result, err os.Error) {
 	c.log(1, "=== Begin store result ===")
 	// Check result
 	if !c.checkResult() {
-		return nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
 	}
 	// Check if result already used/stored
 	if c.result.mode != RESULT_UNUSED {
-		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Set storage mode
 	c.result.mode = RESULT_STORED
@@ -265,11 +418,23 @@ func (c *Client) StoreResult() (result *Result, err os.Error) {
 		return
 	}
 	c.result.allRead = true
+	// Check store limits, the result is freed if exceeded
+	if c.result.storeErr != nil {
+		err = c.result.storeErr
+		c.freeResult()
+		return nil, err
+	}
 	return c.result, nil
 }
 
 // Use a result set, does not store rows
 func (c *Client) UseResult() (result *Result, err os.Error) {
+	// Lock client
+	err = c.acquire(nil, "result")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
 	// Auto reconnect
 	defer func() {
 		err = c.simpleReconnect(err)
@@ -278,11 +443,11 @@ func (c *Client) UseResult() (result *Result, err os.Error) {
 	c.log(1, "=== Begin use result ===")
 	// Check result
 	if !c.checkResult() {
-		return nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
 	}
 	// Check if result already used/stored
 	if c.result.mode != RESULT_UNUSED {
-		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Set storage mode
 	c.result.mode = RESULT_USED
@@ -291,6 +456,17 @@ func (c *Client) UseResult() (result *Result, err os.Error) {
 
 // Free the current result
 func (c *Client) FreeResult() (err os.Error) {
+	// Lock client
+	err = c.acquire(nil, "result")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	return c.freeResult()
+}
+
+// Free the current result without locking
+func (c *Client) freeResult() (err os.Error) {
 	// Auto reconnect
 	defer func() {
 		err = c.simpleReconnect(err)
@@ -299,7 +475,7 @@ func (c *Client) FreeResult() (err os.Error) {
 	c.log(1, "=== Begin free result ===")
 	// Check result
 	if !c.checkResult() {
-		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
 	}
 	// Check for unread rows
 	if !c.result.allRead {
@@ -314,8 +490,9 @@ func (c *Client) FreeResult() (err os.Error) {
 	c.result.fieldCount = 0
 	c.result.fieldPos = 0
 	c.result.fields = nil
+	c.result.columns = nil
 	c.result.rowPos = 0
-	c.result.rows = nil
+	c.result.freeStore()
 	c.result.mode = RESULT_UNUSED
 	c.result.allRead = false
 	// Unset the result
@@ -328,8 +505,20 @@ func (c *Client) MoreResults() bool {
 	return c.serverStatus&SERVER_MORE_RESULTS_EXISTS > 0
 }
 
+// Check if a transaction is in progress, including transactions not started
+// with Begin and XA transactions that have not been committed or rolled back
+func (c *Client) InTransaction() bool {
+	return c.connected && (c.serverStatus&SERVER_STATUS_IN_TRANS > 0 || c.xid != nil)
+}
+
 // Move to the next available result
 func (c *Client) NextResult() (more bool, err os.Error) {
+	// Lock client
+	err = c.acquire(nil, "result")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
 	// Auto reconnect
 	defer func() {
 		err = c.simpleReconnect(err)
@@ -338,7 +527,7 @@ func (c *Client) NextResult() (more bool, err os.Error) {
 	c.log(1, "=== Begin next result ===")
 	// Pre-run checks
 	if !c.checkConn() || c.checkResult() {
-		return false, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return false, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Check for more results
 	more = c.MoreResults()
@@ -357,28 +546,27 @@ func (c *Client) NextResult() (more bool, err os.Error) {
 func (c *Client) SetAutoCommit(state bool) (err os.Error) {
 	// Log set autocommit
 	c.log(1, "=== Begin set autocommit ===")
-	// Use set autocommit query
-	sql := "set autocommit="
-	if state {
-		sql += "1"
-	} else {
-		sql += "0"
-	}
-	return c.Query(sql)
+	// Use session variable, restored on reconnect
+	return c.SetVariable("autocommit", state)
 }
 
-// Start a transaction
-func (c *Client) Start() (err os.Error) {
+// Start a transaction, the transaction can be ended with Client.Commit or
+// Client.Rollback or via the returned Tx
+func (c *Client) Start() (tx *Tx, err os.Error) {
 	// Log start transaction
 	c.log(1, "=== Begin start transaction ===")
-	// Use start transaction query
-	return c.Query("start transaction")
+	// Use default options
+	return c.Begin()
 }
 
 // Commit a transaction
 func (c *Client) Commit() (err os.Error) {
 	// Log commit
 	c.log(1, "=== Begin commit ===")
+	// Commit via the transaction to run hooks
+	if c.tx != nil {
+		return c.tx.Commit()
+	}
 	// Use commit query
 	return c.Query("commit")
 }
@@ -387,10 +575,47 @@ func (c *Client) Commit() (err os.Error) {
 func (c *Client) Rollback() (err os.Error) {
 	// Log rollback
 	c.log(1, "=== Begin rollback ===")
+	// Rollback via the transaction to run hooks
+	if c.tx != nil {
+		return c.tx.Rollback()
+	}
 	// Use rollback query
 	return c.Query("rollback")
 }
 
+// Change the connection charset and optionally the collation
+func (c *Client) SetNames(charset string, collation ...string) (err os.Error) {
+	// Log set names
+	c.log(1, "=== Begin set names ===")
+	// Check charset and collation
+	col := CollationByName(charset)
+	if col == nil || col.Charset != charset {
+		return &ClientError{CR_CANT_READ_CHARSET, c.fmtError(CR_CANT_READ_CHARSET_STR, charset, "compiled"), nil}
+	}
+	sql := "set names '" + charset + "'"
+	if len(collation) > 0 {
+		col = CollationByName(collation[0])
+		if col == nil || col.Name != collation[0] || col.Charset != charset {
+			return &ClientError{CR_CANT_READ_CHARSET, c.fmtError(CR_CANT_READ_CHARSET_STR, collation[0], "compiled"), nil}
+		}
+		sql += " collate '" + col.Name + "'"
+	}
+	// Use set names query
+	err = c.Query(sql)
+	if err != nil {
+		return
+	}
+	// Store for reconnect
+	c.collation = col.Id
+	c.Charset = col.Name
+	return
+}
+
+// Get the connection collation
+func (c *Client) CurrentCollation() *Collation {
+	return CollationById(c.collation)
+}
+
 // Escape a string
 func (c *Client) Escape(s string) (esc string) {
 	var prev byte
@@ -415,7 +640,7 @@ func (c *Client) Escape(s string) (esc string) {
 func (c *Client) InitStmt() (stmt *Statement, err os.Error) {
 	// Check connection
 	if !c.checkConn() {
-		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Create new statement
 	stmt = new(Statement)
@@ -438,10 +663,14 @@ func (c *Client) Prepare(sql string) (stmt *Statement, err os.Error) {
 // Reset the client
 func (c *Client) reset() {
 	c.sequence = 0
-	c.serverStatus = 0
+	// Transaction state is kept as error packets do not include the status
+	c.serverStatus &= SERVER_STATUS_IN_TRANS | SERVER_STATUS_AUTOCOMMIT
 	c.AffectedRows = 0
 	c.LastInsertId = 0
 	c.Warnings = 0
+	if c.result != nil {
+		c.result.freeStore()
+	}
 	c.result = nil
 }
 
@@ -512,12 +741,130 @@ func (c *Client) logStatus() {
 	c.log(3, "Metadata has changed: %d", c.serverStatus&SERVER_STATUS_METADATA_CHANGED>>10)
 }
 
-// Check if connected
-// @todo expand to perform an actual connection check
+// Check if connected, with auto reconnect enabled an idle connection is
+// checked and reconnected if it is no longer alive. Connections in a
+// transaction are not checked, the next command fails instead and the
+// transaction is reported as lost
 func (c *Client) checkConn() bool {
-	if c.connected {
+	if !c.connected {
+		return false
+	}
+	if !c.Reconnect || c.restoring || c.InTransaction() || c.pending() {
+		return true
+	}
+	if !c.alive() {
+		c.log(1, "!!! Connection is not alive !!!")
+		c.connected = false
+		c.conn.Close()
+		if c.reconnect() != nil {
+			return false
+		}
+	}
+	return c.connected
+}
+
+// Check if the connection is alive, the socket is checked for EOF without
+// blocking and the server is pinged. Returns true if a result is being read
+// as the connection can't be checked until the result is freed
+func (c *Client) IsAlive() bool {
+	if !c.connected {
+		return false
+	}
+	// Lock client
+	if c.acquire(nil, "ping") != nil {
+		return false
+	}
+	defer c.unlock()
+	if c.pending() {
+		return true
+	}
+	return c.probe() && c.ping() == nil
+}
+
+// Ping the server
+func (c *Client) Ping() (err os.Error) {
+	// Lock client
+	err = c.acquireNew("ping")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	// Auto reconnect
+	defer func() {
+		err = c.simpleReconnect(err)
+	}()
+	// Log ping
+	c.log(1, "=== Begin ping ===")
+	// Pre-run checks
+	if !c.checkConn() || c.checkResult() {
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	return c.ping()
+}
+
+// Send a ping command
+func (c *Client) ping() (err os.Error) {
+	// Reset client
+	c.reset()
+	// Send ping command
+	err = c.command(COM_PING)
+	if err != nil {
+		return
+	}
+	// Read result from server
+	c.sequence++
+	_, err = c.getResult(PACKET_OK | PACKET_ERROR)
+	return
+}
+
+// Check if an idle connection is alive based on the idle time, the socket is
+// checked after 1 second and pinged after PingIdleTime
+func (c *Client) alive() bool {
+	idle := time.Nanoseconds() - c.lastUsed
+	if c.MaxIdleTime > 0 && idle > c.MaxIdleTime {
+		c.log(1, "Connection idle for %dms, MaxIdleTime exceeded", idle/1000000)
+		return false
+	}
+	if idle >= 1000000000 && !c.probe() {
+		return false
+	}
+	if c.PingIdleTime > 0 && idle >= c.PingIdleTime {
+		return c.ping() == nil
+	}
+	return true
+}
+
+// Check the socket for EOF without blocking, data received while no result
+// is pending means the server has closed the connection (e.g. a timeout error)
+func (c *Client) probe() bool {
+	conn, ok := c.conn.(net.Conn)
+	if !ok {
+		return true
+	}
+	conn.SetReadTimeout(1)
+	defer conn.SetReadTimeout(0)
+	_, err := conn.Read(make([]byte, 1))
+	if err == nil {
+		c.log(1, "Unexpected data received on idle connection")
+		return false
+	}
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		return true
+	}
+	c.log(1, "Idle connection closed: %s", err)
+	return false
+}
+
+// Check if a result or column stream is being read from the connection
+func (c *Client) pending() bool {
+	if c.result != nil || c.stream != nil {
 		return true
 	}
+	for _, s := range c.stmts {
+		if s.result != nil {
+			return true
+		}
+	}
 	return false
 }
 
@@ -541,6 +888,10 @@ func (c *Client) checkNet(err os.Error) bool {
 
 // Performs the actual connect
 func (c *Client) connect() (err os.Error) {
+	// XA transactions end with the connection
+	c.xid = nil
+	// New connections are not idle
+	c.lastUsed = time.Nanoseconds()
 	// Connect to server
 	err = c.dial()
 	if err != nil {
@@ -590,10 +941,10 @@ func (c *Client) dial() (err os.Error) {
 	if err != nil {
 		// Store error state
 		if c.network == UNIX {
-			err = &ClientError{CR_CONNECTION_ERROR, c.fmtError(CR_CONNECTION_ERROR_STR, c.raddr)}
+			err = &ClientError{CR_CONNECTION_ERROR, c.fmtError(CR_CONNECTION_ERROR_STR, c.raddr), err}
 		}
 		if c.network == TCP {
-			err = &ClientError{CR_CONN_HOST_ERROR, c.fmtError(CR_CONN_HOST_ERROR_STR, c.raddr)}
+			err = &ClientError{CR_CONN_HOST_ERROR, c.fmtError(CR_CONN_HOST_ERROR_STR, c.raddr), err}
 		}
 		// Log error
 		if cErr, ok := err.(*ClientError); ok {
@@ -656,11 +1007,20 @@ func (c *Client) init() (err os.Error) {
 func (c *Client) auth() (err os.Error) {
 	// Log write packet
 	c.log(1, "Sending authentication packet to server")
+	// Use requested charset or server default
+	c.collation = uint16(c.serverCharset)
+	if c.Charset != "" {
+		col := CollationByName(c.Charset)
+		if col == nil || col.Id > 0xff {
+			return &ClientError{CR_CANT_READ_CHARSET, c.fmtError(CR_CANT_READ_CHARSET_STR, c.Charset, "compiled"), nil}
+		}
+		c.collation = col.Id
+	}
 	// Construct packet
 	p := &packetAuth{
 		clientFlags:   uint32(CLIENT_MULTI_STATEMENTS | CLIENT_MULTI_RESULTS),
 		maxPacketSize: MAX_PACKET_SIZE,
-		charsetNumber: c.serverCharset,
+		charsetNumber: uint8(c.collation),
 		user:          c.user,
 	}
 	// Add protocol and sequence
@@ -679,6 +1039,11 @@ func (c *Client) auth() (err os.Error) {
 	// Check protocol
 	if c.protocol == PROTOCOL_41 {
 		p.clientFlags |= uint32(CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONN)
+		// Session tracking reports changes to the current database
+		if c.serverFlags&CLIENT_SESSION_TRACK > 0 {
+			p.clientFlags |= uint32(CLIENT_SESSION_TRACK)
+			c.r.sessionTrack = true
+		}
 		p.scrambleBuff = scramble41(c.scrambleBuff, []byte(c.passwd))
 		// To specify a db name
 		if c.serverFlags&CLIENT_CONNECT_WITH_DB > 0 && len(c.dbname) > 0 {
@@ -700,69 +1065,146 @@ func (c *Client) auth() (err os.Error) {
 
 // Simple non-recovered reconnect
 func (c *Client) simpleReconnect(err os.Error) os.Error {
-	if err != nil && c.checkNet(err) && c.Reconnect {
-		c.log(1, "!!! Lost connection to server !!!")
-		c.connected = false
-		rcErr := c.reconnect()
-		if rcErr != nil {
-			return rcErr
+	return c.safeReconnect(err, false, nil)
+}
+
+// Reconnect if a network error occurs and replay the command with fn if safe
+// is set. Commands run in a transaction are never replayed as the transaction
+// is lost with the connection, a CR_TRANSACTION_LOST error is returned instead
+func (c *Client) safeReconnect(err os.Error, safe bool, fn func() os.Error) os.Error {
+	if err == nil || !c.checkNet(err) || !c.Reconnect || c.restoring {
+		return err
+	}
+	c.log(1, "!!! Lost connection to server !!!")
+	inTrans := c.InTransaction()
+	c.connected = false
+	rcErr := c.reconnect()
+	if rcErr != nil {
+		return rcErr
+	}
+	switch {
+	case inTrans:
+		c.log(1, "Transaction lost with connection, command not replayed")
+		return &ClientError{CR_TRANSACTION_LOST, CR_TRANSACTION_LOST_STR, err}
+	case fn == nil:
+		return err
+	case !safe:
+		c.log(1, "Command may have been applied, not replayed")
+		return &ClientError{CR_COMMAND_NOT_REPLAYED, CR_COMMAND_NOT_REPLAYED_STR, err}
+	}
+	return fn()
+}
+
+// Check if a query only reads data and can be safely run twice, multiple
+// statements and SELECT ... INTO are treated as writes
+func isReadQuery(sql string) bool {
+	sql = strings.ToUpper(strings.TrimLeft(sql, " \t\r\n("))
+	if strings.Contains(sql, ";") || strings.Contains(sql, "INTO") {
+		return false
+	}
+	for _, word := range []string{"SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN"} {
+		if strings.HasPrefix(sql, word) {
+			if len(sql) == len(word) {
+				return true
+			}
+			switch sql[len(word)] {
+			case ' ', '\t', '\r', '\n', '(', '*':
+				return true
+			}
 		}
 	}
-	return err
+	return false
 }
 
 // Perform reconnect if a network error occurs
 func (c *Client) reconnect() (err os.Error) {
 	// Log auto reconnect
 	c.log(1, "=== Begin auto reconnect attempt ===")
+	// Any transaction is rolled back when the connection is lost
+	c.abortTx()
 	// Reset the client
 	c.reset()
 	// Attempt to reconnect
-	for i := 0; i < 10; i++ {
+	p := c.reconnectPolicy()
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		if p.cancelled() {
+			err = &ClientError{CR_RECONNECT_CANCELLED, CR_RECONNECT_CANCELLED_STR, err}
+			break
+		}
 		err = c.connect()
+		if p.OnReconnect != nil {
+			p.OnReconnect(i+1, err)
+		}
 		if err == nil {
+			c.log(1, "Reconnected after %d attempt(s)", i+1)
 			c.connected = true
 			break
 		}
-		time.Sleep(2000000000)
+		// Close the failed connection
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.log(1, "Reconnect attempt %d failed: %s", i+1, err)
+		if i+1 < attempts {
+			if !p.wait(p.delay(i)) {
+				err = &ClientError{CR_RECONNECT_CANCELLED, CR_RECONNECT_CANCELLED_STR, err}
+				break
+			}
+		}
 	}
-	return
+	if err != nil {
+		c.log(1, "Reconnect failed: %s", err)
+		return
+	}
+	// Restore session state
+	return c.restoreSession()
 }
 
 // Send a command to the server
 func (c *Client) command(command command, args ...interface{}) (err os.Error) {
 	// Log write packet
 	c.log(1, "Sending command packet to server")
+	// Store time for idle checks
+	c.lastUsed = time.Nanoseconds()
+	// Store query for transaction checks
+	c.lastSql = ""
+	if command == COM_QUERY && len(args) == 1 {
+		c.lastSql, _ = args[0].(string)
+	}
 	// Simple validation, arg count
 	switch command {
 	// No args
 	case COM_QUIT, COM_STATISTICS, COM_PROCESS_INFO, COM_DEBUG, COM_PING:
 		if len(args) != 0 {
-			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 		}
 	// 1 arg
 	case COM_INIT_DB, COM_QUERY, COM_REFRESH, COM_SHUTDOWN, COM_PROCESS_KILL, COM_STMT_PREPARE, COM_STMT_CLOSE, COM_STMT_RESET:
 		if len(args) != 1 {
-			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 		}
 	// 1 or 2 args
 	case COM_FIELD_LIST:
 		if len(args) != 1 && len(args) != 2 {
-			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 		}
 	// 2 args
 	case COM_STMT_FETCH:
 		if len(args) != 2 {
-			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 		}
 	// 4 args
 	case COM_CHANGE_USER:
 		if len(args) != 4 {
-			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+			return &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 		}
 	// Everything else e.g. replication unsupported
 	default:
-		return &ClientError{CR_NOT_IMPLEMENTED, CR_NOT_IMPLEMENTED_STR}
+		return &ClientError{CR_NOT_IMPLEMENTED, CR_NOT_IMPLEMENTED_STR, nil}
 	}
 	// Construct packet
 	p := &packetCommand{
@@ -775,7 +1217,7 @@ func (c *Client) command(command command, args ...interface{}) (err os.Error) {
 	// Write packet
 	err = c.w.writePacket(p)
 	if err != nil {
-		return &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR}
+		return &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, err}
 	}
 	// Log write success
 	c.log(1, "[%d] Sent command packet", p.sequence)
@@ -786,7 +1228,7 @@ func (c *Client) command(command command, args ...interface{}) (err os.Error) {
 func (c *Client) getFields() (err os.Error) {
 	// Check for a valid result
 	if c.result == nil {
-		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
 	}
 	// Read fields till EOF is returned
 	for {
@@ -806,7 +1248,12 @@ func (c *Client) getFields() (err os.Error) {
 func (c *Client) getRow() (eof bool, err os.Error) {
 	// Check for a valid result
 	if c.result == nil {
-		return false, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return false, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	// Finish any open column stream
+	err = c.closeStream()
+	if err != nil {
+		return
 	}
 	// Read next row packet or EOF
 	c.sequence++
@@ -840,7 +1287,7 @@ func (c *Client) getResult(types packetType) (eof bool, err os.Error) {
 	// Process result packet
 	switch p.(type) {
 	default:
-		err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+		err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 	case *packetOK:
 		err = handleOK(p.(*packetOK), c, &c.AffectedRows, &c.LastInsertId, &c.Warnings)
 	case *packetError:
@@ -849,7 +1296,7 @@ func (c *Client) getResult(types packetType) (eof bool, err os.Error) {
 		eof = true
 		err = handleEOF(p.(*packetEOF), c)
 	case *packetResultSet:
-		c.result = &Result{c: c}
+		c.result = &Result{c: c, owner: c.lockHolder()}
 		err = handleResultSet(p.(*packetResultSet), c, c.result)
 	case *packetField:
 		err = handleField(p.(*packetField), c, c.result)
@@ -863,7 +1310,7 @@ func (c *Client) getResult(types packetType) (eof bool, err os.Error) {
 func (c *Client) checkSequence(sequence uint8) (err os.Error) {
 	if sequence != c.sequence {
 		c.log(1, "Sequence doesn't match - expected %d but got %d, commands out of sync", c.sequence, sequence)
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	return
 }
@@ -6,11 +6,16 @@
 package mysql
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"rand"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -46,6 +51,12 @@ const (
 	// All types table queries
 	CREATE_ALLTYPES = "CREATE TABLE `all_types` (`id` SERIAL NOT NULL, `tiny_int` TINYINT NOT NULL, `tiny_uint` TINYINT UNSIGNED NOT NULL, `small_int` SMALLINT NOT NULL, `small_uint` SMALLINT UNSIGNED NOT NULL, `medium_int` MEDIUMINT NOT NULL, `medium_uint` MEDIUMINT UNSIGNED NOT NULL, `int` INT NOT NULL, `uint` INT UNSIGNED NOT NULL, `big_int` BIGINT NOT NULL, `big_uint` BIGINT UNSIGNED NOT NULL, `decimal` DECIMAL(10,4) NOT NULL, `float` FLOAT NOT NULL, `double` DOUBLE NOT NULL, `real` REAL NOT NULL, `bit` BIT(32) NOT NULL, `boolean` BOOLEAN NOT NULL, `date` DATE NOT NULL, `datetime` DATETIME NOT NULL, `timestamp` TIMESTAMP NOT NULL, `time` TIME NOT NULL, `year` YEAR NOT NULL, `char` CHAR(32) NOT NULL, `varchar` VARCHAR(32) NOT NULL, `tiny_text` TINYTEXT NOT NULL, `text` TEXT NOT NULL, `medium_text` MEDIUMTEXT NOT NULL, `long_text` LONGTEXT NOT NULL, `binary` BINARY(32) NOT NULL, `var_binary` VARBINARY(32) NOT NULL, `tiny_blob` TINYBLOB NOT NULL, `medium_blob` MEDIUMBLOB NOT NULL, `blob` BLOB NOT NULL, `long_blob` LONGBLOB NOT NULL, `enum` ENUM('a','b','c','d','e') NOT NULL, `set` SET('a','b','c','d','e') NOT NULL, `geometry` GEOMETRY NOT NULL) ENGINE = InnoDB CHARACTER SET utf8 COLLATE utf8_unicode_ci COMMENT = 'GoMySQL Test Suite All Types Table'"
 	DROP_ALLTYPES   = "DROP TABLE `all_types`"
+
+	// Nullable table queries
+	CREATE_NULLABLE      = "CREATE TABLE `nullable` (`id` SERIAL NOT NULL, `number` BIGINT NULL, `string` VARCHAR(32) NULL, `float` DOUBLE NULL, `datetime` DATETIME NULL) ENGINE = InnoDB CHARACTER SET utf8 COLLATE utf8_unicode_ci COMMENT = 'GoMySQL Test Suite Nullable Table'"
+	SELECT_NULLABLE      = "SELECT * FROM nullable ORDER BY id"
+	INSERT_NULLABLE_STMT = "INSERT INTO nullable VALUES (null, ?, ?, ?, ?)"
+	DROP_NULLABLE        = "DROP TABLE `nullable`"
 )
 
 var (
@@ -186,7 +197,7 @@ func TestSimple(t *testing.T) {
 			break
 		}
 		id := row[0].(uint64)
-		num, str1, str2 := strconv.Itoa64(row[1].(int64)), row[2].(string), string(row[3].([]byte))
+		num, str1, str2 := strconv.Itoa64(row[1].(int64)), row[2].(string), row[3].(string)
 		if rowMap[id][0] != num || rowMap[id][1] != str1 || rowMap[id][2] != str2 {
 			t.Logf("String from database doesn't match local string")
 			t.Fail()
@@ -235,7 +246,7 @@ func TestSimple(t *testing.T) {
 			break
 		}
 		id := row[0].(uint64)
-		num, str1, str2 := strconv.Itoa64(row[1].(int64)), row[2].(string), string(row[3].([]byte))
+		num, str1, str2 := strconv.Itoa64(row[1].(int64)), row[2].(string), row[3].(string)
 		if rowMap[id][0] != num || rowMap[id][1] != str1 || rowMap[id][2] != str2 {
 			t.Logf("%#v %#v", rowMap[id], row)
 			t.Logf("String from database doesn't match local string")
@@ -449,6 +460,1691 @@ func TestSimpleStatement(t *testing.T) {
 	}
 }
 
+// Test NULL values are returned in the correct columns and bound to nullable types
+func TestNullStatement(t *testing.T) {
+	t.Logf("Running nullable table statement tests")
+	db, err = DialUnix(TEST_SOCK, TEST_USER, TEST_PASSWD, TEST_DBNAME)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Create table")
+	err = db.Query(CREATE_NULLABLE)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Prepare insert")
+	stmt, err := db.Prepare(INSERT_NULLABLE_STMT)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Insert null and non-null records")
+	params := [][]interface{}{
+		{nil, nil, nil, nil},
+		{int64(-5), "abc", 1.5, nil},
+		{nil, "def", nil, "2011-05-31 12:30:45"},
+	}
+	for _, p := range params {
+		err = stmt.BindParams(p...)
+		if err != nil {
+			t.Logf("Error %s", err)
+			t.Fail()
+		}
+		err = stmt.Execute()
+		if err != nil {
+			t.Logf("Error %s", err)
+			t.Fail()
+		}
+	}
+
+	t.Logf("Prepare select")
+	err = stmt.Prepare(SELECT_NULLABLE)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Execute select")
+	err = stmt.Execute()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Bind result")
+	var id uint64
+	var number NullInt64
+	var str *string
+	var float NullFloat64
+	var datetime NullTime
+	stmt.BindResult(&id, &number, &str, &float, &datetime)
+
+	t.Logf("Validate null data")
+	for i := 0; ; i++ {
+		eof, err := stmt.Fetch()
+		if err != nil {
+			t.Logf("Error %s", err)
+			t.Fail()
+			break
+		}
+		if eof {
+			break
+		}
+		p := params[i]
+		if number.Valid != (p[0] != nil) || (str != nil) != (p[1] != nil) || float.Valid != (p[2] != nil) || datetime.Valid != (p[3] != nil) {
+			t.Logf("Null flags for row %d don't match inserted data", i)
+			t.Fail()
+		}
+		if str != nil && *str != p[1].(string) {
+			t.Logf("String from database doesn't match local string")
+			t.Fail()
+		}
+		if datetime.Valid && datetime.DateTime.String() != p[3].(string) {
+			t.Logf("Datetime from database doesn't match local datetime")
+			t.Fail()
+		}
+	}
+
+	t.Logf("Free result")
+	err = stmt.FreeResult()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Close statement")
+	err = stmt.Close()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Drop table")
+	err = db.Query(DROP_NULLABLE)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Close connection")
+	err = db.Close()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+}
+
+// Type registered with conversion functions
+type testPoint struct {
+	X, Y int
+}
+
+// Type implementing ValueConverter
+type testUpper string
+
+func (u testUpper) ConvertValue() (interface{}, os.Error) {
+	return strings.ToUpper(string(u)), nil
+}
+
+// Type implementing Scanner
+type testScanner struct {
+	value interface{}
+	valid bool
+}
+
+func (s *testScanner) Scan(value interface{}) os.Error {
+	s.value, s.valid = value, value != nil
+	return nil
+}
+
+// Test a registered type as a param and a result
+func TestRegisterType(t *testing.T) {
+	RegisterType(testPoint{}, func(param interface{}) (interface{}, os.Error) {
+		var p testPoint
+		switch v := param.(type) {
+		case testPoint:
+			p = v
+		case *testPoint:
+			p = *v
+		}
+		return fmt.Sprintf("%d,%d", p.X, p.Y), nil
+	}, func(dst, value interface{}) os.Error {
+		_, err := fmt.Sscanf(atos(value), "%d,%d", &dst.(*testPoint).X, &dst.(*testPoint).Y)
+		return err
+	})
+	pt := testPoint{3, 4}
+	for _, param := range []interface{}{pt, &pt} {
+		v, err := convertParam(param)
+		if err != nil || v != "3,4" {
+			t.Errorf("Converted %#v to %#v (%s), expected \"3,4\"", param, v, err)
+		}
+	}
+	if lookupScan(reflect.TypeOf(pt)) != nil {
+		t.Errorf("Found a scan function for a non-pointer destination")
+	}
+	var dst testPoint
+	if err := scanRow(Row{[]byte("3,4")}, []interface{}{&dst}); err != nil || dst.X != 3 || dst.Y != 4 {
+		t.Errorf("Scanned %#v (%s), expected %#v", dst, err, pt)
+	}
+}
+
+// Test types implementing ValueConverter and Scanner
+func TestConverterInterfaces(t *testing.T) {
+	if v, err := convertParam(testUpper("abc")); err != nil || v != "ABC" {
+		t.Errorf("Converted testUpper to %#v (%s), expected \"ABC\"", v, err)
+	}
+	if v, err := convertParam(nil); err != nil || v != nil {
+		t.Errorf("Converted nil to %#v (%s), expected nil", v, err)
+	}
+	if v, err := convertParam(int64(5)); err != nil || v != int64(5) {
+		t.Errorf("Converted int64 to %#v (%s), expected it unchanged", v, err)
+	}
+	var s1, s2 testScanner
+	if err := scanRow(Row{"abc", nil}, []interface{}{&s1, &s2}); err != nil {
+		t.Errorf("Scan returned %s", err)
+	}
+	if !s1.valid || s1.value != "abc" || s2.valid || s2.value != nil {
+		t.Errorf("Scanned %#v and %#v, expected \"abc\" and NULL", s1, s2)
+	}
+}
+
+// Test an unsupported destination type
+func TestScanUnsupported(t *testing.T) {
+	var c complex128
+	err := scanRow(Row{"1"}, []interface{}{&c})
+	if cErr, ok := err.(*ClientError); !ok || cErr.Errno != CR_UNSUPPORTED_PARAM_TYPE {
+		t.Errorf("Scan to *complex128 returned %#v, expected CR_UNSUPPORTED_PARAM_TYPE", err)
+	}
+	if err := scanRow(Row{"1"}, []interface{}{&c, &c}); err == nil {
+		t.Errorf("Scan of 2 destinations from 1 column succeeded")
+	}
+}
+
+// Date/time values encoded in the binary protocol MYSQL_TIME format
+var mysqlTimeTests = []struct {
+	v    interface{}
+	data []byte
+}{
+	{Date{2011, 9, 30}, []byte{4, 0xdb, 0x07, 9, 30}},
+	{Date{0, 0, 0}, []byte{4, 0, 0, 0, 0}},
+	{Time{13, 45, 7}, []byte{8, 0, 0, 0, 0, 0, 13, 45, 7}},
+	{DateTime{2011, 12, 31, 23, 59, 58}, []byte{7, 0xdb, 0x07, 12, 31, 23, 59, 58}},
+}
+
+// Test encoding of date/time params
+func TestMysqlTime(t *testing.T) {
+	for _, test := range mysqlTimeTests {
+		var b []byte
+		switch v := test.v.(type) {
+		case Date:
+			b = datetob(v)
+		case Time:
+			b = timetob(v)
+		case DateTime:
+			b = datetimetob(v)
+		}
+		if !bytes.Equal(b, test.data) {
+			t.Errorf("Encoded %#v as %v, expected %v", test.v, b, test.data)
+		}
+	}
+}
+
+// Params converted to the type expected by the server
+var coerceParamTests = []struct {
+	param interface{}
+	p     Param
+	v     interface{}
+	ok    bool
+}{
+	{nil, Param{Type: FIELD_TYPE_LONG}, nil, true},
+	{5, Param{Type: FIELD_TYPE_NEWDECIMAL}, "5", true},
+	{uint8(7), Param{Type: FIELD_TYPE_NEWDECIMAL}, "7", true},
+	{1.5, Param{Type: FIELD_TYPE_DECIMAL}, "1.5", true},
+	{"12.34", Param{Type: FIELD_TYPE_NEWDECIMAL}, "12.34", true},
+	{"abc", Param{Type: FIELD_TYPE_NEWDECIMAL}, "abc", false},
+	{3.0, Param{Type: FIELD_TYPE_LONG}, int64(3), true},
+	{3.5, Param{Type: FIELD_TYPE_LONG}, int64(3), false},
+	{"42", Param{Type: FIELD_TYPE_LONGLONG}, int64(42), true},
+	{"42", Param{Type: FIELD_TYPE_LONGLONG, Flags: FLAG_UNSIGNED}, uint64(42), true},
+	{"-1", Param{Type: FIELD_TYPE_LONGLONG, Flags: FLAG_UNSIGNED}, uint64(0), false},
+	{"2.5", Param{Type: FIELD_TYPE_DOUBLE}, 2.5, true},
+	{"2011-09-30", Param{Type: FIELD_TYPE_DATE}, Date{2011, 9, 30}, true},
+	{Time{10, 11, 12}, Param{Type: FIELD_TYPE_DATE}, nil, false},
+	{Date{2011, 9, 30}, Param{Type: FIELD_TYPE_DATETIME}, DateTime{2011, 9, 30, 0, 0, 0}, true},
+	{"2011-09-30 10:11:12", Param{Type: FIELD_TYPE_DATETIME}, DateTime{2011, 9, 30, 10, 11, 12}, true},
+	{"10:11:12", Param{Type: FIELD_TYPE_TIME}, Time{10, 11, 12}, true},
+	{"abc", Param{Type: FIELD_TYPE_VAR_STRING}, "abc", true},
+}
+
+// Test conversion of params using param metadata
+func TestCoerceParam(t *testing.T) {
+	for _, test := range coerceParamTests {
+		p := test.p
+		v, ok := coerceParam(test.param, &p)
+		if ok != test.ok {
+			t.Errorf("Param %#v for type %d returned ok %t, expected %t", test.param, test.p.Type, ok, test.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(v, test.v) {
+			t.Errorf("Param %#v for type %d returned %#v, expected %#v", test.param, test.p.Type, v, test.v)
+		}
+	}
+}
+
+// In memory connection for protocol tests
+type testConn struct {
+	bytes.Buffer
+}
+
+func (c *testConn) Close() os.Error {
+	return nil
+}
+
+// Long data chunk sizes, sizes lists the data length of each packet sent
+var longDataTests = []struct {
+	length    int
+	chunkSize int
+	sizes     []int
+}{
+	{0, 4, []int{0}},
+	{3, 4, []int{3}},
+	{8, 4, []int{4, 4}},
+	{9, 4, []int{4, 4, 1}},
+	{5, 0, []int{5}},
+	{5, -1, []int{5}},
+}
+
+// Test chunking of long data sent from a reader
+func TestSendLongDataReader(t *testing.T) {
+	for _, test := range longDataTests {
+		conn := new(testConn)
+		s := &Statement{c: &Client{w: newWriter(conn)}, statementId: 1}
+		data := []byte(randString(test.length))
+		err := s.sendLongDataReader(2, bytes.NewBuffer(data), test.chunkSize)
+		if err != nil {
+			t.Errorf("Sending %d bytes in chunks of %d returned %s", test.length, test.chunkSize, err)
+			continue
+		}
+		// Unpack the data sent from each packet
+		var sizes []int
+		var sent []byte
+		b := conn.Bytes()
+		for len(b) >= 4 {
+			n := int(btoui24(b[0:3]))
+			sizes = append(sizes, n-7)
+			sent = append(sent, b[11:4+n]...)
+			b = b[4+n:]
+		}
+		if !reflect.DeepEqual(sizes, test.sizes) || !bytes.Equal(sent, data) {
+			t.Errorf("Sending %d bytes in chunks of %d sent packets of %v, expected %v", test.length, test.chunkSize, sizes, test.sizes)
+		}
+	}
+}
+
+// Split a payload into packets starting at sequence seq
+func testPackets(seq uint8, payload []byte) (b []byte) {
+	for {
+		n := len(payload)
+		if n > MAX_PACKET_SIZE {
+			n = MAX_PACKET_SIZE
+		}
+		b = append(b, byte(n), byte(n>>8), byte(n>>16), seq)
+		b = append(b, payload[:n]...)
+		payload = payload[n:]
+		seq++
+		if n < MAX_PACKET_SIZE {
+			return
+		}
+	}
+	return
+}
+
+// Length coded string
+func testLcs(s []byte) []byte {
+	if len(s) < 251 {
+		return append([]byte{byte(len(s))}, s...)
+	}
+	b := append([]byte{0xfe}, ui64tob(uint64(len(s)))...)
+	return append(b, s...)
+}
+
+// Fields used by the stream tests, column 2 is streamed
+var streamFields = []*Field{
+	&Field{Name: "id", Type: FIELD_TYPE_LONGLONG},
+	&Field{Name: "n", Type: FIELD_TYPE_LONG},
+	&Field{Name: "data", Type: FIELD_TYPE_BLOB, Flags: FLAG_BINARY},
+	&Field{Name: "tail", Type: FIELD_TYPE_VAR_STRING, Flags: FLAG_BINARY},
+}
+
+// Streamed column lengths, values longer than MAX_PACKET_SIZE span packets
+var streamTests = []struct {
+	length int
+	binary bool
+}{
+	{0, false},
+	{5, false},
+	{300, false},
+	{MAX_PACKET_SIZE + 10, false},
+	{5, true},
+	{300, true},
+	{MAX_PACKET_SIZE + 10, true},
+}
+
+// Build a row packet with columns 7, NULL, data, "x" followed by an EOF packet
+func streamRow(data []byte, binary bool) []byte {
+	var payload []byte
+	if binary {
+		// Null bit map with column 1 set, bit offset is 2
+		payload = append([]byte{0, 0x08}, ui64tob(7)...)
+	} else {
+		payload = append(testLcs([]byte("7")), 0xfb)
+	}
+	switch {
+	case data != nil:
+		payload = append(payload, testLcs(data)...)
+	case binary:
+		payload[1] |= 0x10
+	default:
+		payload = append(payload, 0xfb)
+	}
+	payload = append(payload, testLcs([]byte("x"))...)
+	// EOF packet follows the last row packet
+	seq := uint8(len(payload)/MAX_PACKET_SIZE) + 2
+	return append(testPackets(1, payload), testPackets(seq, []byte{0xfe, 0, 0, 2, 0})...)
+}
+
+// Create a client and result reading from an in memory connection
+func streamResult(b []byte) (c *Client, r *Result) {
+	conn := new(testConn)
+	conn.Write(b)
+	c = &Client{r: newReader(conn)}
+	r = &Result{c: c, fields: streamFields, fieldCount: uint64(len(streamFields)), mode: RESULT_USED}
+	return
+}
+
+// Check the row returned with a streamed column
+func checkStreamRow(t *testing.T, row Row, length interface{}) {
+	expected := Row{int64(7), nil, length, []byte("x")}
+	if !reflect.DeepEqual(row, expected) {
+		t.Errorf("Streamed row %#v, expected %#v", row, expected)
+	}
+}
+
+// Check the next read is the end of the result
+func checkStreamEOF(t *testing.T, c *Client, r *Result, binary bool) {
+	eof, _, _, err := c.getRowStream(r, 2, binary, nil)
+	if !eof || err != nil {
+		t.Errorf("Read after streamed row returned eof %t (%s), expected EOF", eof, err)
+	}
+}
+
+// Test streaming a column including values spanning multiple packets
+func TestRowStream(t *testing.T) {
+	for _, test := range streamTests {
+		data := make([]byte, test.length)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		c, r := streamResult(streamRow(data, test.binary))
+		eof, row, rd, err := c.getRowStream(r, 2, test.binary, nil)
+		if eof || err != nil || rd == nil {
+			t.Errorf("Streaming %d bytes returned eof %t, reader %v (%s)", test.length, eof, rd, err)
+			continue
+		}
+		b, err := ioutil.ReadAll(rd)
+		if err != nil || !bytes.Equal(b, data) {
+			t.Errorf("Streamed %d bytes (%s), expected %d", len(b), err, test.length)
+		}
+		if c.stream != nil {
+			t.Errorf("Stream still open after reading %d bytes", test.length)
+		}
+		checkStreamRow(t, row, uint64(test.length))
+		checkStreamEOF(t, c, r, test.binary)
+	}
+}
+
+// Test streaming a NULL column
+func TestRowStreamNull(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		c, r := streamResult(streamRow(nil, binary))
+		eof, row, rd, err := c.getRowStream(r, 2, binary, nil)
+		if eof || err != nil || rd != nil {
+			t.Errorf("Streaming NULL returned eof %t, reader %v (%s), expected no reader", eof, rd, err)
+			continue
+		}
+		checkStreamRow(t, row, nil)
+		checkStreamEOF(t, c, r, binary)
+	}
+}
+
+// Test closing a partly read stream
+func TestCloseStream(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		c, r := streamResult(streamRow([]byte("abcdef"), binary))
+		_, row, rd, err := c.getRowStream(r, 2, binary, nil)
+		if err != nil || rd == nil {
+			t.Errorf("Streaming returned reader %v (%s)", rd, err)
+			continue
+		}
+		b := make([]byte, 2)
+		if n, err := rd.Read(b); n != 2 || err != nil {
+			t.Errorf("Read %d bytes (%s), expected 2", n, err)
+		}
+		if err = c.closeStream(); err != nil || c.stream != nil {
+			t.Errorf("Close stream returned %s, stream %v", err, c.stream)
+		}
+		if n, err := rd.Read(b); n != 0 || err != os.EOF {
+			t.Errorf("Read after close returned %d bytes (%s), expected EOF", n, err)
+		}
+		checkStreamRow(t, row, uint64(6))
+		checkStreamEOF(t, c, r, binary)
+	}
+}
+
+// Create a stored result with 3 rows, rows after the first are spilled to disk
+func rowsResult(t *testing.T) (c *Client, r *Result) {
+	c = &Client{SpillBytes: 20}
+	r = &Result{c: c, fields: []*Field{&Field{Name: "id"}, &Field{Name: "name"}}, mode: RESULT_STORED, allRead: true}
+	for i := 0; i < 3; i++ {
+		r.storeRow(Row{int64(i), "0123456789"})
+	}
+	if r.storeErr != nil || r.spill == nil {
+		t.Fatalf("Rows not spilled (%s)", r.storeErr)
+	}
+	c.result = r
+	return
+}
+
+// Test iterating a stored result
+func TestRows(t *testing.T) {
+	c, r := rowsResult(t)
+	rows := r.Rows()
+	if len(rows.Fields()) != 2 {
+		t.Errorf("Got %d fields, expected 2", len(rows.Fields()))
+	}
+	n := 0
+	for rows.Next() {
+		if id, _ := rows.Row().Int64(0); id != int64(n) {
+			t.Errorf("Row %d is %#v", n, rows.Row())
+		}
+		n++
+	}
+	if n != 3 || rows.Err() != nil {
+		t.Errorf("Read %d rows (%s), expected 3", n, rows.Err())
+	}
+	if err := rows.Close(); err != nil || c.result != nil {
+		t.Errorf("Close returned %s", err)
+	}
+	if rows.Next() || rows.Close() != nil {
+		t.Errorf("Rows usable after close")
+	}
+}
+
+// Test an error part way through the rows
+func TestRowsError(t *testing.T) {
+	c, r := rowsResult(t)
+	// Spilled rows can no longer be read
+	r.spill.file.Close()
+	rows := r.Rows()
+	if !rows.Next() || rows.Err() != nil {
+		t.Fatalf("First row not read (%s)", rows.Err())
+	}
+	if rows.Next() || rows.Row() != nil || rows.Err() == nil {
+		t.Errorf("Read of a spilled row returned %#v (%s), expected an error", rows.Row(), rows.Err())
+	}
+	// Iteration stays stopped
+	if rows.Next() {
+		t.Errorf("Next succeeded after an error")
+	}
+	if err := rows.Close(); err != nil || c.result != nil {
+		t.Errorf("Close returned %s", err)
+	}
+	if cErr, ok := rows.Scan(new(int)).(*ClientError); !ok || cErr.Errno != CR_NO_DATA {
+		t.Errorf("Scan after close returned %#v, expected CR_NO_DATA", cErr)
+	}
+}
+
+// Test statement row fields are read once there is a result
+func TestStatementRowsFields(t *testing.T) {
+	c, r := rowsResult(t)
+	s := &Statement{c: c}
+	rows := s.Rows()
+	if rows.Fields() != nil {
+		t.Errorf("Got fields before execute")
+	}
+	s.result = r
+	if len(rows.Fields()) != 2 {
+		t.Errorf("Got %d fields after execute, expected 2", len(rows.Fields()))
+	}
+}
+
+// Row used by the typed accessor tests
+var accessorRow = Row{int64(-5), uint64(7), "3.5", []byte("abc"), nil, "2011-09-30 10:11:12", Date{2011, 9, 30}, "10:11:12"}
+
+// Typed accessor results, err is true if the accessor should fail
+var rowAccessorTests = []struct {
+	fn  string
+	i   int
+	v   interface{}
+	err bool
+}{
+	{"Int64", 0, int64(-5), false},
+	{"Uint64", 1, uint64(7), false},
+	{"Int64", 1, int64(7), false},
+	{"Float64", 2, 3.5, false},
+	{"Int64", 2, int64(0), true},
+	{"Int64", 3, int64(0), true},
+	{"String", 0, "-5", false},
+	{"String", 3, "abc", false},
+	{"Bytes", 2, []byte("3.5"), false},
+	{"Bytes", 3, []byte("abc"), false},
+	{"Int64", 4, int64(0), false},
+	{"String", 4, "", false},
+	{"Bytes", 4, []byte(nil), false},
+	{"Time", 5, DateTime{2011, 9, 30, 10, 11, 12}, false},
+	{"Time", 6, DateTime{2011, 9, 30, 0, 0, 0}, false},
+	{"Time", 7, DateTime{0, 0, 0, 10, 11, 12}, false},
+	{"Time", 1, DateTime{}, true},
+	{"Int64", 8, int64(0), true},
+	{"String", -1, "", true},
+}
+
+// Test typed row accessors
+func TestRowAccessors(t *testing.T) {
+	for _, test := range rowAccessorTests {
+		var v interface{}
+		var err os.Error
+		switch test.fn {
+		case "Int64":
+			v, err = accessorRow.Int64(test.i)
+		case "Uint64":
+			v, err = accessorRow.Uint64(test.i)
+		case "Float64":
+			v, err = accessorRow.Float64(test.i)
+		case "String":
+			v, err = accessorRow.String(test.i)
+		case "Bytes":
+			v, err = accessorRow.Bytes(test.i)
+		case "Time":
+			v, err = accessorRow.Time(test.i)
+		}
+		if (err != nil) != test.err {
+			t.Errorf("Row.%s(%d) returned error %v, expected error %t", test.fn, test.i, err, test.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(v, test.v) {
+			t.Errorf("Row.%s(%d) returned %#v, expected %#v", test.fn, test.i, v, test.v)
+		}
+	}
+	if !accessorRow.IsNull(4) || accessorRow.IsNull(0) || accessorRow.IsNull(8) {
+		t.Errorf("Row.IsNull returned wrong values")
+	}
+}
+
+// Row seeks on a stored result of 3 rows, row is the next row fetched
+var rowSeekTests = []struct {
+	offset uint64
+	row    Row
+	err    bool
+}{
+	{0, Row{int64(0)}, false},
+	{2, Row{int64(2)}, false},
+	{1, Row{int64(1)}, false},
+	{3, nil, false},
+	{4, nil, true},
+}
+
+// Test seeking rows of a stored result
+func TestRowSeek(t *testing.T) {
+	r := &Result{mode: RESULT_STORED, rows: []Row{{int64(0)}, {int64(1)}, {int64(2)}}}
+	for _, test := range rowSeekTests {
+		prev := r.RowTell()
+		p, err := r.RowSeek(test.offset)
+		if (err != nil) != test.err {
+			t.Errorf("RowSeek(%d) returned error %v, expected error %t", test.offset, err, test.err)
+			continue
+		}
+		if err != nil {
+			if r.RowTell() != prev {
+				t.Errorf("RowSeek(%d) failed but moved position from %d to %d", test.offset, prev, r.RowTell())
+			}
+			continue
+		}
+		if p != prev {
+			t.Errorf("RowSeek(%d) returned previous position %d, expected %d", test.offset, p, prev)
+		}
+		row := r.FetchRow()
+		if !reflect.DeepEqual(row, test.row) {
+			t.Errorf("Row after RowSeek(%d) is %#v, expected %#v", test.offset, row, test.row)
+		}
+	}
+	err := r.DataSeek(1)
+	if err != nil || r.RowTell() != 1 {
+		t.Errorf("DataSeek(1) returned error %v and position %d", err, r.RowTell())
+	}
+	// Only stored results can be seeked
+	u := &Result{mode: RESULT_USED}
+	if err := u.DataSeek(0); err == nil {
+		t.Errorf("DataSeek on a used result didn't return an error")
+	}
+}
+
+// Field seeks on a result of 2 fields, name is the next field fetched
+var fieldSeekTests = []struct {
+	offset uint64
+	pos    uint64
+	name   string
+}{
+	{1, 1, "b"},
+	{0, 0, "a"},
+	{2, 2, ""},
+	{5, 2, ""},
+}
+
+// Test seeking fields
+func TestFieldSeek(t *testing.T) {
+	r := &Result{fields: []*Field{&Field{Name: "a"}, &Field{Name: "b"}}}
+	for _, test := range fieldSeekTests {
+		r.FieldSeek(test.offset)
+		if r.FieldTell() != test.pos {
+			t.Errorf("FieldSeek(%d) set position %d, expected %d", test.offset, r.FieldTell(), test.pos)
+		}
+		f := r.FetchField()
+		if test.name == "" && f != nil || test.name != "" && (f == nil || f.Name != test.name) {
+			t.Errorf("Field after FieldSeek(%d) is %#v, expected %s", test.offset, f, test.name)
+		}
+	}
+}
+
+// Rows written to and read back from a spill file
+var spillRows = []Row{
+	{nil, int64(-1), uint64(1<<63 + 5), float32(1.5), -2.25},
+	{[]byte{0, 1, 0xff}, "text", "", []byte{}},
+	{Date{2011, 9, 30}, Time{23, 59, 58}, DateTime{2011, 12, 31, 1, 2, 3}},
+	{},
+}
+
+// Test rows stored in a temporary file are read back unchanged
+func TestSpillFile(t *testing.T) {
+	s, err := newSpillFile("")
+	if err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	defer s.close()
+	for _, row := range spillRows {
+		err = s.write(row)
+		if err != nil {
+			t.Fatalf("Error %s", err)
+		}
+	}
+	if s.count() != uint64(len(spillRows)) {
+		t.Errorf("Spill file has %d rows, expected %d", s.count(), len(spillRows))
+	}
+	// Read in reverse order to check rows are found by offset
+	for i := len(spillRows) - 1; i >= 0; i-- {
+		row, err := s.read(uint64(i))
+		if err != nil {
+			t.Errorf("Error %s", err)
+			continue
+		}
+		if len(row) != len(spillRows[i]) || len(row) > 0 && !reflect.DeepEqual(row, spillRows[i]) {
+			t.Errorf("Row %d read as %#v, expected %#v", i, row, spillRows[i])
+		}
+	}
+	// Unsupported values are not written
+	if s.write(Row{struct{}{}}) == nil {
+		t.Errorf("Unsupported value was written")
+	}
+}
+
+// Test a stored result spills rows after SpillBytes and frees the file
+func TestStoreSpill(t *testing.T) {
+	r := &Result{c: &Client{SpillBytes: 20}, mode: RESULT_STORED}
+	for i := 0; i < 10; i++ {
+		r.storeRow(Row{int64(i), "0123456789"})
+	}
+	if r.storeErr != nil {
+		t.Fatalf("Error %s", r.storeErr)
+	}
+	if r.spill == nil || len(r.rows) != 1 || r.storedRows() != 10 {
+		t.Fatalf("Expected 1 row in memory and 10 stored, got %d and %d", len(r.rows), r.storedRows())
+	}
+	rows := r.FetchRows()
+	for i, row := range rows {
+		if n, _ := row.Int64(0); n != int64(i) {
+			t.Errorf("Row %d is %#v", i, row)
+		}
+	}
+	r.freeStore()
+	if r.spill != nil || r.storedRows() != 0 {
+		t.Errorf("Stored rows not freed")
+	}
+	// Limits
+	r = &Result{c: &Client{MaxStoreRows: 2}, mode: RESULT_STORED}
+	for i := 0; i < 3; i++ {
+		r.storeRow(Row{int64(i)})
+	}
+	if cErr, ok := r.storeErr.(*ClientError); !ok || cErr.Errno != CR_RESULT_ROW_LIMIT || r.storedRows() != 2 {
+		t.Errorf("Expected row limit error with 2 rows stored, got %v with %d rows", r.storeErr, r.storedRows())
+	}
+}
+
+// Build a 4.1 field packet, def is appended after the fixed length part
+func fieldPacket(flags FieldFlag, def []byte) []byte {
+	b := []byte("\x03def\x04test\x01t\x01t\x02id\x02id\x0c\x3f\x00\x0b\x00\x00\x00\x03")
+	b = append(b, byte(flags), byte(flags>>8), 0, 0, 0)
+	return append(b, def...)
+}
+
+// Field packets, hasDefault is only set for a non NULL default value
+var fieldPacketTests = []struct {
+	data       []byte
+	def        string
+	hasDefault bool
+	pri        bool
+	nullable   bool
+	unsigned   bool
+}{
+	{fieldPacket(FLAG_NOT_NULL|FLAG_PRI_KEY|FLAG_UNSIGNED, []byte("\x015")), "5", true, true, false, true},
+	{fieldPacket(0, []byte("\x00")), "", true, false, true, false},
+	{fieldPacket(FLAG_UNSIGNED, []byte("\xfb")), "", false, false, true, true},
+	{fieldPacket(FLAG_NOT_NULL, nil), "", false, false, false, false},
+}
+
+// Test reading field packets including the default value from COM_FIELD_LIST
+func TestFieldPacket(t *testing.T) {
+	for i, test := range fieldPacketTests {
+		p := new(packetField)
+		p.protocol = PROTOCOL_41
+		if err := p.read(test.data); err != nil {
+			t.Errorf("Field %d returned error %s", i, err)
+			continue
+		}
+		r := &Result{mode: RESULT_STORED}
+		if err := handleField(p, &Client{}, r); err != nil || len(r.fields) != 1 {
+			t.Errorf("Field %d not stored (%s)", i, err)
+			continue
+		}
+		f := r.fields[0]
+		if f.Name != "id" || f.Type != FIELD_TYPE_LONG || f.Length != 11 {
+			t.Errorf("Field %d read as %#v", i, f)
+		}
+		if f.Default != test.def || f.HasDefault != test.hasDefault {
+			t.Errorf("Field %d default %q (%t), expected %q (%t)", i, f.Default, f.HasDefault, test.def, test.hasDefault)
+		}
+		if f.IsPrimaryKey() != test.pri || f.IsNullable() != test.nullable || f.IsUnsigned() != test.unsigned {
+			t.Errorf("Field %d primary key %t, nullable %t, unsigned %t, expected %t, %t, %t", i, f.IsPrimaryKey(), f.IsNullable(), f.IsUnsigned(), test.pri, test.nullable, test.unsigned)
+		}
+	}
+}
+
+// Column data converted to UTF-8 by charset
+var decodeCharsetTests = []struct {
+	charset uint16
+	in      []byte
+	out     string
+}{
+	{8, []byte("abc"), "abc"},
+	{8, []byte{'a', 0xe9}, "aé"},
+	{8, []byte{0x80, 0x9f}, "€Ÿ"},
+	{8, []byte{0x81}, "\u0081"},
+	{47, []byte{0xe9}, "é"},
+	{33, []byte("é"), "é"},
+	{63, []byte{0xe9}, "\xe9"},
+	{0, []byte{0xe9}, "\xe9"},
+}
+
+// Test charset conversion of column data
+func TestDecodeCharset(t *testing.T) {
+	for _, test := range decodeCharsetTests {
+		out := decodeCharset(test.charset, test.in)
+		if string(out) != test.out {
+			t.Errorf("Charset %d data %v decoded as %q, expected %q", test.charset, test.in, out, test.out)
+		}
+	}
+}
+
+// String and blob column values, binary charsets and collations stay bytes
+var textValueTests = []struct {
+	f Field
+	v interface{}
+}{
+	{Field{Type: FIELD_TYPE_VAR_STRING, Charset: 33}, "aé"},
+	{Field{Type: FIELD_TYPE_BLOB, Charset: 8}, "aé"},
+	{Field{Type: FIELD_TYPE_VAR_STRING, Charset: 83, Flags: FLAG_BINARY}, []byte("aé")},
+	{Field{Type: FIELD_TYPE_STRING, Charset: 47, Flags: FLAG_BINARY}, []byte("aé")},
+	{Field{Type: FIELD_TYPE_BLOB, Charset: CHARSET_BINARY, Flags: FLAG_BINARY}, []byte("aé")},
+	{Field{Type: FIELD_TYPE_BLOB, Flags: FLAG_BINARY}, []byte("aé")},
+}
+
+// Test values and Go types of string and blob columns
+func TestTextValue(t *testing.T) {
+	for _, test := range textValueTests {
+		f := test.f
+		in := []byte("aé")
+		if f.Charset == 8 {
+			in = []byte{'a', 0xe9}
+		}
+		v := textValue(&f, in)
+		if !reflect.DeepEqual(v, test.v) {
+			t.Errorf("Charset %d flags %d value %#v, expected %#v", f.Charset, f.Flags, v, test.v)
+		}
+		if f.GoType() != reflect.TypeOf(test.v) {
+			t.Errorf("Charset %d flags %d type %s, expected %T", f.Charset, f.Flags, f.GoType(), test.v)
+		}
+	}
+}
+
+// Error packets, errno 0 means the packet is malformed
+var errorPacketTests = []struct {
+	protocol uint8
+	data     []byte
+	errno    uint16
+	state    string
+	str      string
+}{
+	{PROTOCOL_41, []byte("\xff\x7a\x04#42S02Unknown table"), 1146, "42S02", "#1146 (42S02) Unknown table"},
+	{PROTOCOL_41, []byte("\xff\x15\x04Access denied"), 1045, "", "#1045 Access denied"},
+	{PROTOCOL_40, []byte("\xff\x7a\x04#Unknown table"), 1146, "", "#1146 #Unknown table"},
+	{PROTOCOL_41, []byte{0xff, 0x7a, 0x04, '#', '4', '2'}, 0, "", ""},
+	{PROTOCOL_41, []byte{0xff, 0x7a}, 0, "", ""},
+}
+
+// Test reading the error number, SQLSTATE and message from error packets
+func TestErrorPacket(t *testing.T) {
+	for _, test := range errorPacketTests {
+		p := new(packetError)
+		p.protocol = test.protocol
+		err := p.read(test.data)
+		if test.errno == 0 {
+			if cErr, ok := err.(*ClientError); !ok || cErr.Errno != CR_MALFORMED_PACKET {
+				t.Errorf("Packet %v returned %v, expected malformed packet", test.data, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error %s", err)
+			continue
+		}
+		if p.errno != test.errno || p.state != test.state {
+			t.Errorf("Packet %v read as #%d (%s), expected #%d (%s)", test.data, p.errno, p.state, test.errno, test.state)
+		}
+		sErr := &ServerError{Errno: Errno(p.errno), Error: Error(p.error), SQLState: p.state}
+		if sErr.String() != test.str {
+			t.Errorf("Error string is %q, expected %q", sErr.String(), test.str)
+		}
+	}
+}
+
+// Errors classified as retryable
+var retryableTests = []struct {
+	err       os.Error
+	retryable bool
+}{
+	{&ServerError{Errno: ER_LOCK_DEADLOCK, Error: "Deadlock found", SQLState: "40001"}, true},
+	{&ServerError{Errno: ER_LOCK_WAIT_TIMEOUT, Error: "Lock wait timeout exceeded", SQLState: "HY000"}, true},
+	{&ServerError{Errno: ER_OPTION_PREVENTS_STATEMENT, Error: "The MySQL server is running with the --read-only option", SQLState: "HY000"}, true},
+	{&ServerError{Errno: ER_CON_COUNT_ERROR, Error: "Too many connections", SQLState: "08004"}, true},
+	{&ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, &ServerError{Errno: ER_LOCK_DEADLOCK, Error: "Deadlock found"}}, true},
+	{&ServerError{Errno: ER_DUP_ENTRY, Error: "Duplicate entry", SQLState: "23000"}, false},
+	{&ServerError{Errno: ER_PARSE_ERROR, Error: "You have an error in your SQL syntax", SQLState: "42000"}, false},
+	{&ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, os.EOF}, false},
+	{os.EOF, false},
+	{nil, false},
+}
+
+// Test retryable error classification
+func TestIsRetryable(t *testing.T) {
+	for _, test := range retryableTests {
+		if IsRetryable(test.err) != test.retryable {
+			t.Errorf("IsRetryable(%v) returned %t, expected %t", test.err, !test.retryable, test.retryable)
+		}
+	}
+}
+
+// Transaction options converted to SQL
+var txOptionsTests = []struct {
+	o     TxOptions
+	level string
+	sql   string
+}{
+	{TxOptions{}, "DEFAULT", "START TRANSACTION"},
+	{TxOptions{Isolation: ISOLATION_READ_UNCOMMITTED}, "READ UNCOMMITTED", "START TRANSACTION"},
+	{TxOptions{Isolation: ISOLATION_READ_COMMITTED, Access: ACCESS_READ_ONLY}, "READ COMMITTED", "START TRANSACTION READ ONLY"},
+	{TxOptions{Isolation: ISOLATION_REPEATABLE_READ, Access: ACCESS_READ_WRITE}, "REPEATABLE READ", "START TRANSACTION READ WRITE"},
+	{TxOptions{Isolation: ISOLATION_SERIALIZABLE, ConsistentSnapshot: true}, "SERIALIZABLE", "START TRANSACTION WITH CONSISTENT SNAPSHOT"},
+	{TxOptions{Access: ACCESS_READ_ONLY, ConsistentSnapshot: true}, "DEFAULT", "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"},
+}
+
+// Test conversion of transaction options
+func TestTxOptions(t *testing.T) {
+	for _, test := range txOptionsTests {
+		if level := test.o.Isolation.String(); level != test.level {
+			t.Errorf("Isolation level %d is %q, expected %q", test.o.Isolation, level, test.level)
+		}
+		if sql := test.o.startSql(); sql != test.sql {
+			t.Errorf("Options %#v started with %q, expected %q", test.o, sql, test.sql)
+		}
+	}
+}
+
+// Identifiers quoted for savepoint names
+var quoteNameTests = []struct {
+	name   string
+	quoted string
+}{
+	{"sp", "`sp`"},
+	{"", "``"},
+	{"a b", "`a b`"},
+	{"a`b", "`a``b`"},
+	{"``", "``````"},
+}
+
+// Test quoting of identifiers
+func TestQuoteName(t *testing.T) {
+	for _, test := range quoteNameTests {
+		if quoted := quoteName(test.name); quoted != test.quoted {
+			t.Errorf("Name %q quoted as %s, expected %s", test.name, quoted, test.quoted)
+		}
+	}
+}
+
+// Test nested transaction savepoint names are unique in the outer transaction
+func TestSavepointNames(t *testing.T) {
+	root := &Tx{}
+	child := &Tx{parent: root}
+	grandchild := &Tx{parent: child}
+	names := []string{root.nextSavepoint(), child.nextSavepoint(), grandchild.nextSavepoint(), root.nextSavepoint()}
+	expected := []string{"gomysql_0", "gomysql_1", "gomysql_2", "gomysql_3"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Savepoint names %v, expected %v", names, expected)
+	}
+	if child.seq != 0 || grandchild.seq != 0 {
+		t.Errorf("Savepoint sequence kept by a nested transaction")
+	}
+	// A new transaction starts again
+	if name := (&Tx{}).nextSavepoint(); name != "gomysql_0" {
+		t.Errorf("Savepoint name %s in new transaction, expected gomysql_0", name)
+	}
+}
+
+// Xids encoded as SQL
+var xidStringTests = []struct {
+	xid *Xid
+	sql string
+}{
+	{&Xid{1, []byte("order-1"), []byte("db1")}, "X'6f726465722d31',X'646231',1"},
+	{&Xid{0, []byte{0, 0xff}, nil}, "X'00ff',X'',0"},
+	{&Xid{-1, nil, nil}, "X'',X'',-1"},
+}
+
+// Test Xid SQL encoding and comparison
+func TestXid(t *testing.T) {
+	for _, test := range xidStringTests {
+		if test.xid.String() != test.sql {
+			t.Errorf("Xid %#v encoded as %s, expected %s", test.xid, test.xid.String(), test.sql)
+		}
+		if !test.xid.Equal(&Xid{test.xid.FormatId, test.xid.Gtrid, test.xid.Bqual}) {
+			t.Errorf("Xid %#v not equal to a copy", test.xid)
+		}
+		if test.xid.Equal(&Xid{test.xid.FormatId + 1, test.xid.Gtrid, test.xid.Bqual}) || test.xid.Equal(nil) {
+			t.Errorf("Xid %#v equal to a different xid", test.xid)
+		}
+	}
+}
+
+// XA RECOVER rows, xid is nil if the row is malformed
+var xaRecoverTests = []struct {
+	row Row
+	xid *Xid
+}{
+	{Row{int64(1), int64(7), int64(3), "order-1db1"}, &Xid{1, []byte("order-1"), []byte("db1")}},
+	{Row{int64(2), int64(2), int64(0), []byte{0, 0xff}}, &Xid{2, []byte{0, 0xff}, []byte{}}},
+	{Row{int64(1), int64(0), int64(0), ""}, &Xid{1, []byte{}, []byte{}}},
+	{Row{int64(1), int64(7), int64(4), "order-1db1"}, nil},
+	{Row{int64(1), int64(-1), int64(3), "order-1db1"}, nil},
+	{Row{int64(1), int64(7), int64(3)}, nil},
+	{Row{"x", int64(7), int64(3), "order-1db1"}, nil},
+}
+
+// Test parsing of XA RECOVER rows
+func TestParseXid(t *testing.T) {
+	for _, test := range xaRecoverTests {
+		xid, err := parseXid(test.row)
+		if test.xid == nil {
+			if err == nil {
+				t.Errorf("Row %#v parsed as %#v, expected an error", test.row, xid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Row %#v returned error %s", test.row, err)
+			continue
+		}
+		if !xid.Equal(test.xid) {
+			t.Errorf("Row %#v parsed as %#v, expected %#v", test.row, xid, test.xid)
+		}
+	}
+}
+
+// Create a client with an open transaction, the hooks count their calls
+func txClient() (c *Client, tx *Tx, commits, rollbacks *int) {
+	c = &Client{w: newWriter(new(testConn)), connected: true, serverStatus: SERVER_STATUS_IN_TRANS}
+	tx = &Tx{c: c}
+	c.tx = tx
+	commits, rollbacks = new(int), new(int)
+	tx.OnCommit(func() {
+		*commits++
+	})
+	tx.OnRollback(func() {
+		*rollbacks++
+	})
+	return
+}
+
+// Queries that end a transaction, commit is true if the hooks for a commit
+// should run
+var txEndTests = []struct {
+	sql    string
+	commit bool
+}{
+	{"COMMIT", true},
+	{"create table t (id int)", true},
+	{" DROP TABLE t", true},
+	{"begin", true},
+	{"START TRANSACTION", true},
+	{"LOCK TABLES t WRITE", true},
+	{"SET autocommit = 1", true},
+	{"ROLLBACK", false},
+	{"rollback work", false},
+	{"INSERT INTO t VALUES (1)", false},
+	{"SELECT 1", false},
+	{"CALL proc()", false},
+}
+
+// Test transactions ended by a query outside of the Tx methods
+func TestTxEnd(t *testing.T) {
+	for _, test := range txEndTests {
+		c, tx, commits, rollbacks := txClient()
+		if err := c.command(COM_QUERY, test.sql); err != nil {
+			t.Fatalf("Error %s", err)
+		}
+		c.sequence = 1
+		var a, i uint64
+		var w uint16
+		handleOK(&packetOK{packetBase: packetBase{sequence: 1}, serverStatus: uint16(SERVER_STATUS_AUTOCOMMIT)}, c, &a, &i, &w)
+		errno := CR_TRANSACTION_ROLLED_BACK
+		if test.commit {
+			errno = CR_TRANSACTION_IMPLICIT
+		}
+		if cErr, ok := tx.Commit().(*ClientError); !ok || cErr.Errno != errno {
+			t.Errorf("Commit after %q returned %#v, expected %d", test.sql, cErr, errno)
+		}
+		if test.commit && (*commits != 1 || *rollbacks != 0) || !test.commit && (*commits != 0 || *rollbacks != 1) {
+			t.Errorf("Query %q ran %d commit and %d rollback hooks", test.sql, *commits, *rollbacks)
+		}
+		if c.tx != nil {
+			t.Errorf("Transaction still open after %q", test.sql)
+		}
+	}
+}
+
+// Test transactions rolled back by a deadlock and by a lost connection
+func TestTxAborted(t *testing.T) {
+	// Deadlock
+	c, tx, commits, rollbacks := txClient()
+	err := handleError(&packetError{errno: uint16(ER_LOCK_DEADLOCK)}, c)
+	if sErr, ok := err.(*ServerError); !ok || sErr.Errno != ER_LOCK_DEADLOCK || c.InTransaction() {
+		t.Errorf("Deadlock returned %#v, in transaction %t", err, c.InTransaction())
+	}
+	if err = tx.Rollback(); err != nil || *commits != 0 || *rollbacks != 1 {
+		t.Errorf("Rollback after deadlock returned %s, ran %d commit and %d rollback hooks", err, *commits, *rollbacks)
+	}
+	// Lost connection, the reconnect fails
+	c, tx, commits, rollbacks = txClient()
+	c.network, c.raddr = UNIX, "/nonexistent/gomysql.sock"
+	c.ReconnectPolicy = &ReconnectPolicy{MaxAttempts: 1}
+	if err = c.reconnect(); err == nil {
+		t.Fatalf("Reconnect succeeded")
+	}
+	if cErr, ok := tx.Commit().(*ClientError); !ok || cErr.Errno != CR_TRANSACTION_ROLLED_BACK {
+		t.Errorf("Commit after lost connection returned %#v, expected CR_TRANSACTION_ROLLED_BACK", cErr)
+	}
+	if *commits != 0 || *rollbacks != 1 {
+		t.Errorf("Lost connection ran %d commit and %d rollback hooks", *commits, *rollbacks)
+	}
+	// A later query doesn't change the outcome
+	c, tx, commits, rollbacks = txClient()
+	c.abortTx()
+	c.lastSql = "COMMIT"
+	c.setStatus(SERVER_STATUS_AUTOCOMMIT)
+	if tx.check() == nil || *commits != 0 || *rollbacks != 1 {
+		t.Errorf("Aborted transaction ran %d commit and %d rollback hooks", *commits, *rollbacks)
+	}
+}
+
+// Queries classified as read only
+var readQueryTests = []struct {
+	sql  string
+	read bool
+}{
+	{"SELECT * FROM simple", true},
+	{"select 1", true},
+	{"  \n\tSELECT 1", true},
+	{"(SELECT 1) UNION (SELECT 2)", true},
+	{"SELECT*FROM simple", true},
+	{"SHOW TABLES", true},
+	{"DESCRIBE simple", true},
+	{"DESC simple", true},
+	{"EXPLAIN SELECT 1", true},
+	{"SELECT", true},
+	{"SELECT 1; DELETE FROM simple", false},
+	{"SELECT * INTO OUTFILE '/tmp/x' FROM simple", false},
+	{"SELECTED", false},
+	{"INSERT INTO simple VALUES (1)", false},
+	{"UPDATE simple SET number = 1", false},
+	{"DELETE FROM simple", false},
+	{"", false},
+}
+
+// Test classification of queries that can be run again after reconnecting
+func TestIsReadQuery(t *testing.T) {
+	for _, test := range readQueryTests {
+		if isReadQuery(test.sql) != test.read {
+			t.Errorf("isReadQuery(%q) returned %t, expected %t", test.sql, !test.read, test.read)
+		}
+	}
+}
+
+// OK packets with and without session state tracking
+var okPacketTests = []struct {
+	protocol     uint8
+	sessionTrack bool
+	data         string
+	affectedRows uint64
+	warningCount uint16
+	message      string
+	schema       string
+	err          bool
+}{
+	{PROTOCOL_41, false, "\x00\x01\x02\x02\x00\x01\x00msg", 1, 1, "msg", "", false},
+	{PROTOCOL_40, false, "\x00\x05\x00\x02\x00", 5, 0, "", "", false},
+	{PROTOCOL_41, true, "\x00\x00\x00\x02\x00\x00\x00\x03msg", 0, 0, "msg", "", false},
+	{PROTOCOL_41, true, "\x00\x00\x00\x02\x40\x00\x00\x00\x19\x00\x0e\x0aautocommit\x02ON\x01\x07\x06testdb", 0, 0, "", "testdb", false},
+	{PROTOCOL_41, true, "\x00\x00\x00\x02\x40\x00\x00\x00\x19\x01\x07", 0, 0, "", "", true},
+}
+
+// Test reading OK packets including session state changes
+func TestOKPacket(t *testing.T) {
+	for _, test := range okPacketTests {
+		p := new(packetOK)
+		p.protocol = test.protocol
+		p.sessionTrack = test.sessionTrack
+		err := p.read([]byte(test.data))
+		if (err != nil) != test.err {
+			t.Errorf("Packet %q returned error %v, expected error %t", test.data, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if p.affectedRows != test.affectedRows || p.warningCount != test.warningCount || p.message != test.message {
+			t.Errorf("Packet %q read as %d rows, %d warnings, message %q", test.data, p.affectedRows, p.warningCount, p.message)
+		}
+		if p.schemaChanged != (test.schema != "") || p.schema != test.schema {
+			t.Errorf("Packet %q changed schema to %q, expected %q", test.data, p.schema, test.schema)
+		}
+	}
+}
+
+// Backoff delays without jitter
+var backoffTests = []struct {
+	delay, maxDelay int64
+	multiplier      float64
+	n               int
+	d               int64
+}{
+	{10, 0, 2, 0, 10},
+	{10, 0, 2, 3, 80},
+	{10, 50, 2, 3, 50},
+	{10, 50, 2, 100, 50},
+	{10, 0, 1, 5, 10},
+	{0, 0, 2, 3, 0},
+}
+
+// Test exponential backoff delays
+func TestBackoff(t *testing.T) {
+	for _, test := range backoffTests {
+		d := backoff(test.delay, test.maxDelay, test.multiplier, 0, test.n)
+		if d != test.d {
+			t.Errorf("Backoff %d attempt %d returned %d, expected %d", test.delay, test.n, d, test.d)
+		}
+	}
+	// Jitter stays within the fraction of the delay
+	for i := 0; i < 100; i++ {
+		d := backoff(100, 0, 2, 0.5, 0)
+		if d < 50 || d > 150 {
+			t.Errorf("Backoff with jitter returned %d, expected 50 - 150", d)
+		}
+	}
+}
+
+// Test the goroutine id used for lock deadlock detection
+func TestGoroutineId(t *testing.T) {
+	id := goroutineId()
+	ch := make(chan int64)
+	go func() {
+		ch <- goroutineId()
+	}()
+	other := <-ch
+	if id == 0 || other == 0 || id == other || goroutineId() != id {
+		t.Errorf("Goroutine ids %d and %d, expected distinct non-zero ids", id, other)
+	}
+}
+
+// Test detached results are added to pipeline results unless a limit was exceeded
+func TestStoreDetached(t *testing.T) {
+	res := new(PipelineResult)
+	r := &Result{mode: RESULT_STORED, rows: []Row{{int64(1)}}}
+	err := storeDetached(r, res)
+	if err != nil || len(res.Results) != 1 || !r.detached || !r.allRead {
+		t.Errorf("Result not stored, error %v", err)
+	}
+	r = &Result{mode: RESULT_STORED, rows: []Row{{int64(1)}}}
+	limitErr := &ClientError{CR_RESULT_ROW_LIMIT, CR_RESULT_ROW_LIMIT_STR, nil}
+	r.storeErr = limitErr
+	err = storeDetached(r, res)
+	if err != limitErr || len(res.Results) != 1 || r.rows != nil || r.mode != RESULT_FREE {
+		t.Errorf("Result exceeding limit not freed, error %v", err)
+	}
+}
+
+// Errors returned when a stored result exceeds a limit
+var storeLimitTests = []struct {
+	err   os.Error
+	limit bool
+}{
+	{&ClientError{CR_RESULT_ROW_LIMIT, CR_RESULT_ROW_LIMIT_STR, nil}, true},
+	{&ClientError{CR_RESULT_SIZE_LIMIT, CR_RESULT_SIZE_LIMIT_STR, nil}, true},
+	{&ClientError{CR_RESULT_SPILL_ERROR, CR_RESULT_SPILL_ERROR_STR, nil}, true},
+	{&ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, nil}, false},
+	{&ServerError{Errno: ER_PARSE_ERROR, Error: "You have an error in your SQL syntax", SQLState: "42000"}, false},
+	{nil, false},
+}
+
+// Test which errors leave a pipeline in sync
+func TestIsStoreLimit(t *testing.T) {
+	for _, test := range storeLimitTests {
+		if isStoreLimit(test.err) != test.limit {
+			t.Errorf("isStoreLimit(%v) returned %t, expected %t", test.err, !test.limit, test.limit)
+		}
+	}
+}
+
+// In memory connection with separate buffers for the server responses and
+// the packets sent
+type testServerConn struct {
+	testConn
+	sent bytes.Buffer
+}
+
+func (c *testServerConn) Write(b []byte) (int, os.Error) {
+	return c.sent.Write(b)
+}
+
+// Test params bound again while an execute is pipelined are sent with types
+func TestPipelineRebind(t *testing.T) {
+	conn := new(testServerConn)
+	ok := testPackets(1, []byte{0, 0, 0, 2, 0, 0, 0})
+	conn.testConn.Write(append(ok, ok...))
+	c := &Client{r: newReader(conn), w: newWriter(conn), connected: true}
+	s := &Statement{c: c, prepared: true, statementId: 1, paramCount: 1}
+	if err := s.BindParams(1); err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	p := c.Pipeline()
+	p.Execute(s)
+	if err := s.BindParams("a"); err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	results, err := p.Run()
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Pipeline returned %v (%s)", results, err)
+	}
+	if !s.paramsRebound {
+		t.Errorf("Params bound during the pipeline are not flagged as rebound")
+	}
+	// The new params bound flag follows the header, command, statement id,
+	// flags, iteration count and null bit map
+	conn.sent.Reset()
+	if err = s.Execute(); err != nil {
+		t.Fatalf("Error %s", err)
+	}
+	b := conn.sent.Bytes()
+	if len(b) < 17 || b[15] != 1 || FieldType(b[16]) != FIELD_TYPE_STRING {
+		t.Errorf("Execute sent %v, expected params with types", b)
+	}
+}
+
+// Test queued functions run in order
+func TestEnqueue(t *testing.T) {
+	c := new(Client)
+	ch := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		n := i
+		c.enqueue(func() {
+			ch <- n
+		})
+	}
+	for i := 0; i < 100; i++ {
+		select {
+		case n := <-ch:
+			if n != i {
+				t.Fatalf("Queued function %d ran at position %d", n, i)
+			}
+		case <-time.After(5000000000):
+			t.Fatalf("Queued function %d didn't run", i)
+		}
+	}
+}
+
+// Test asynchronous commands aren't queued without locking
+func TestAsyncLocking(t *testing.T) {
+	c := new(Client)
+	res := <-c.QueryAsync("SELECT 1", nil)
+	if cErr, ok := res.Err.(*ClientError); !ok || cErr.Errno != CR_ASYNC_LOCKING_REQUIRED {
+		t.Errorf("Async query returned %#v, expected CR_ASYNC_LOCKING_REQUIRED", res.Err)
+	}
+	rows, done := c.QueryStreamAsync("SELECT 1", nil)
+	if _, ok := <-rows; ok {
+		t.Errorf("Row received from async query stream")
+	}
+	res = <-done
+	if cErr, ok := res.Err.(*ClientError); !ok || cErr.Errno != CR_ASYNC_LOCKING_REQUIRED {
+		t.Errorf("Async query stream returned %#v, expected CR_ASYNC_LOCKING_REQUIRED", res.Err)
+	}
+	if c.Locking || c.asyncRunning || len(c.asyncQueue) != 0 {
+		t.Errorf("Locking %t, queue running %t with %d commands, expected no changes", c.Locking, c.asyncRunning, len(c.asyncQueue))
+	}
+}
+
+// Session variable names, names that aren't plain identifiers are rejected
+var variableNameTests = []struct {
+	name  string
+	valid bool
+}{
+	{"time_zone", true},
+	{"@@session.sql_mode", true},
+	{"innodb_lock_wait_timeout", true},
+	{"", false},
+	{"@@", false},
+	{"@user_var", false},
+	{"sql_mode=''; DROP TABLE simple; SET @a", false},
+	{"time zone", false},
+	{"`time_zone`", false},
+}
+
+// Test session variable name validation
+func TestVariableName(t *testing.T) {
+	for _, test := range variableNameTests {
+		if isVariableName(test.name) != test.valid {
+			t.Errorf("isVariableName(%q) returned %t, expected %t", test.name, !test.valid, test.valid)
+		}
+	}
+}
+
+// Test internal locking between goroutines
+func TestLocking(t *testing.T) {
+	t.Logf("Running locking tests")
+	db, err = DialUnix(TEST_SOCK, TEST_USER, TEST_PASSWD, TEST_DBNAME)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+		return
+	}
+	db.Locking = true
+	db.LockTimeout = 5000000000
+
+	t.Logf("Query without freeing result")
+	err = db.Query("SELECT 1")
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Query again from the same goroutine")
+	err = db.Query("SELECT 2")
+	if cErr, ok := err.(*ClientError); !ok || cErr.Errno != CR_LOCK_DEADLOCK {
+		t.Logf("Expected deadlock error, got %v", err)
+		t.Fail()
+	}
+
+	t.Logf("Query from another goroutine")
+	done := make(chan os.Error, 1)
+	go func() {
+		err := db.Query("SELECT 2")
+		if err == nil {
+			err = db.FreeResult()
+		}
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		t.Logf("Query didn't wait for the lock, error %v", err)
+		t.Fail()
+	case <-time.After(100000000):
+	}
+
+	t.Logf("Store result")
+	res, err := db.StoreResult()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Free result from another goroutine")
+	freed := make(chan os.Error, 1)
+	go func() {
+		freed <- res.Free()
+	}()
+	err = <-freed
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Wait for query from other goroutine")
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Logf("Error %s", err)
+			t.Fail()
+		}
+	case <-time.After(5000000000):
+		t.Logf("Query still waiting for the lock")
+		t.Fail()
+	}
+
+	t.Logf("Close connection")
+	err = db.Close()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+}
+
+// Test pipelined queries and statement executes
+func TestPipeline(t *testing.T) {
+	t.Logf("Running pipeline tests")
+	db, err = DialUnix(TEST_SOCK, TEST_USER, TEST_PASSWD, TEST_DBNAME)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+		return
+	}
+
+	t.Logf("Create table")
+	err = db.Query(CREATE_SIMPLE)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Prepare count statement")
+	stmt, err := db.Prepare("SELECT COUNT(*) FROM simple")
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Run pipeline")
+	p := db.Pipeline()
+	p.Query(fmt.Sprintf(INSERT_SIMPLE, 1, "a", "b"))
+	p.Query(fmt.Sprintf(INSERT_SIMPLE, 2, "c", "d"))
+	p.Query("SELECT * FROM simple_nonexistent")
+	p.Query(SELECT_SIMPLE)
+	p.Execute(stmt)
+	if p.Len() != 5 {
+		t.Logf("Pipeline has %d commands, expected 5", p.Len())
+		t.Fail()
+	}
+	results, err := p.Run()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+	if len(results) != 5 {
+		t.Logf("Pipeline returned %d results, expected 5", len(results))
+		t.FailNow()
+	}
+
+	t.Logf("Validate results")
+	for i := 0; i < 2; i++ {
+		if results[i].Err != nil || results[i].AffectedRows != 1 {
+			t.Logf("Insert %d returned error %v and %d affected rows", i, results[i].Err, results[i].AffectedRows)
+			t.Fail()
+		}
+	}
+	if _, ok := results[2].Err.(*ServerError); !ok {
+		t.Logf("Expected server error, got %v", results[2].Err)
+		t.Fail()
+	}
+	if results[3].Err != nil || len(results[3].Results) != 1 || results[3].Results[0].RowCount() != 2 {
+		t.Logf("Select returned error %v and %d results", results[3].Err, len(results[3].Results))
+		t.Fail()
+	}
+	if results[4].Err != nil || len(results[4].Results) != 1 {
+		t.Logf("Execute returned error %v and %d results", results[4].Err, len(results[4].Results))
+		t.Fail()
+	} else if n, _ := results[4].Results[0].FetchRow().Int64(0); n != 2 {
+		t.Logf("Count returned %d, expected 2", n)
+		t.Fail()
+	}
+	for _, res := range results {
+		for _, r := range res.Results {
+			r.Free()
+		}
+	}
+
+	t.Logf("Close statement")
+	err = stmt.Close()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Drop table")
+	err = db.Query(DROP_SIMPLE)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Close connection")
+	err = db.Close()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+}
+
+// Test asynchronous queries and row streaming
+func TestQueryAsync(t *testing.T) {
+	t.Logf("Running async query tests")
+	db, err = DialUnix(TEST_SOCK, TEST_USER, TEST_PASSWD, TEST_DBNAME)
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+		return
+	}
+	db.Locking = true
+
+	t.Logf("Queue queries")
+	cancel := make(chan bool)
+	close(cancel)
+	first := db.QueryAsync("SELECT 1", nil)
+	cancelled := db.QueryAsync("SELECT 2", cancel)
+	last := db.QueryAsync("SELECT 3", nil)
+
+	t.Logf("Validate results")
+	for i, ch := range []<-chan *AsyncResult{first, last} {
+		res := <-ch
+		if res.Err != nil || len(res.Results) != 1 {
+			t.Logf("Query %d returned error %v and %d results", i, res.Err, len(res.Results))
+			t.Fail()
+			continue
+		}
+		if n, _ := res.Results[0].FetchRow().Int64(0); n != int64(i*2+1) {
+			t.Logf("Query %d returned %d, expected %d", i, n, i*2+1)
+			t.Fail()
+		}
+		res.Results[0].Free()
+	}
+	res := <-cancelled
+	if cErr, ok := res.Err.(*ClientError); !ok || cErr.Errno != CR_COMMAND_CANCELLED {
+		t.Logf("Expected cancelled error, got %v", res.Err)
+		t.Fail()
+	}
+
+	t.Logf("Stream rows")
+	rows, done := db.QueryStreamAsync("SELECT 1 UNION SELECT 2 UNION SELECT 3", nil)
+	count := 0
+	for row := range rows {
+		count++
+		if n, _ := row.Int64(0); n != int64(count) {
+			t.Logf("Row %d is %#v", count, row)
+			t.Fail()
+		}
+	}
+	res = <-done
+	if res.Err != nil || count != 3 {
+		t.Logf("Stream returned error %v and %d rows", res.Err, count)
+		t.Fail()
+	}
+
+	t.Logf("Query after async queries")
+	err = db.Query("SELECT 4")
+	if err == nil {
+		err = db.FreeResult()
+	}
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+
+	t.Logf("Close connection")
+	err = db.Close()
+	if err != nil {
+		t.Logf("Error %s", err)
+		t.Fail()
+	}
+}
+
 // Benchmark connect/handshake via TCP
 func BenchmarkDialTCP(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -109,7 +109,7 @@ type packetInit struct {
 	serverVersion   string
 	threadId        uint32
 	scrambleBuff    []byte
-	serverCaps      uint16
+	serverCaps      uint32
 	serverLanguage  uint8
 	serverStatus    uint16
 }
@@ -119,7 +119,7 @@ func (p *packetInit) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position
@@ -142,14 +142,17 @@ func (p *packetInit) read(data []byte) (err os.Error) {
 	p.scrambleBuff = data[pos : pos+8]
 	pos += 9
 	// Server capabilities [16 bit uint]
-	p.serverCaps = btoui16(data[pos : pos+2])
+	p.serverCaps = uint32(btoui16(data[pos : pos+2]))
 	pos += 2
 	// Server language [8 bit uint]
 	p.serverLanguage = data[pos]
 	pos++
 	// Server status [16 bit uint]
 	p.serverStatus = btoui16(data[pos : pos+2])
-	pos += 15
+	pos += 2
+	// Upper server capabilities (4.1+, zero filled otherwise) [16 bit uint]
+	p.serverCaps |= uint32(btoui16(data[pos:pos+2])) << 16
+	pos += 13
 	// Second part of scramble buffer, if exists (4.1+) [13 bytes]
 	if ClientFlag(p.serverCaps)&CLIENT_PROTOCOL_41 > 0 {
 		p.scrambleBuff = append(p.scrambleBuff, data[pos:pos+12]...)
@@ -173,7 +176,7 @@ func (p *packetAuth) write() (data []byte, err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// For MySQL 4.1+
@@ -235,6 +238,11 @@ type packetOK struct {
 	serverStatus uint16
 	warningCount uint16
 	message      string
+
+	// Session state changes, if session tracking is enabled
+	sessionTrack  bool
+	schema        string
+	schemaChanged bool
 }
 
 // OK packet reader
@@ -242,7 +250,7 @@ func (p *packetOK) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position (skip first byte/field count)
@@ -270,9 +278,44 @@ func (p *packetOK) read(data []byte) (err os.Error) {
 		pos += 2
 	}
 	// Message (optional) [string]
-	if pos < len(data) {
+	if pos < len(data) && !p.sessionTrack {
 		p.message = string(data[pos:])
 	}
+	if pos >= len(data) || !p.sessionTrack {
+		return
+	}
+	// Message with session tracking [length coded string]
+	p.message, n, err = p.readLengthCodedString(data[pos:])
+	if err != nil {
+		return
+	}
+	pos += n
+	if ServerStatus(p.serverStatus)&SERVER_SESSION_STATE_CHANGED == 0 {
+		return
+	}
+	// Session state changes [length coded binary]
+	state, _, err := p.readLengthCodedBytes(data[pos:])
+	if err != nil {
+		return
+	}
+	for len(state) > 0 {
+		// Change type [8 bit uint] and data [length coded binary]
+		typ := state[0]
+		var change []byte
+		change, n, err = p.readLengthCodedBytes(state[1:])
+		if err != nil {
+			return
+		}
+		state = state[1+n:]
+		// Current database [length coded string]
+		if typ == SESSION_TRACK_SCHEMA {
+			p.schema, _, err = p.readLengthCodedString(change)
+			if err != nil {
+				return
+			}
+			p.schemaChanged = true
+		}
+	}
 	return
 }
 
@@ -289,7 +332,7 @@ func (p *packetError) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position
@@ -297,8 +340,8 @@ func (p *packetError) read(data []byte) (err os.Error) {
 	// Error number [16 bit uint]
 	p.errno = btoui16(data[pos : pos+2])
 	pos += 2
-	// State (4.1 only) [string]
-	if p.protocol == PROTOCOL_41 {
+	// State (4.1 only) [marker + 5 char string], not sent for errors during handshake
+	if p.protocol == PROTOCOL_41 && pos < len(data) && data[pos] == '#' {
 		pos++
 		p.state = string(data[pos : pos+5])
 		pos += 5
@@ -322,7 +365,7 @@ func (p *packetEOF) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Check for 4.1 protocol AND 2 available bytes
@@ -351,7 +394,7 @@ func (p *packetPassword) write() (data []byte, err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Set scramble
@@ -375,7 +418,7 @@ func (p *packetCommand) write() (data []byte, err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Make slice from command byte
@@ -454,7 +497,7 @@ func (p *packetResultSet) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position and bytes read
@@ -489,7 +532,8 @@ type packetField struct {
 	fieldType     uint8
 	flags         uint16
 	decimals      uint8
-	defaultVal    uint64
+	defaultVal    []byte
+	hasDefault    bool
 }
 
 // Field packet reader
@@ -497,7 +541,7 @@ func (p *packetField) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position and bytes read
@@ -557,9 +601,15 @@ func (p *packetField) read(data []byte) (err os.Error) {
 		// Decimals [8 bit uint]
 		p.decimals = data[pos]
 		pos++
-		// Default value [len coded binary]
-		if pos < len(data) {
-			p.defaultVal, _, err = btolcb(data[pos:])
+		// Filler [2 bytes]
+		pos += 2
+		// Default value [len coded string], only sent for COM_FIELD_LIST
+		if pos < len(data) && data[pos] != 0xfb {
+			p.defaultVal, _, err = p.readLengthCodedBytes(data[pos:])
+			if err != nil {
+				return
+			}
+			p.hasDefault = true
 		}
 	} else {
 		// Table [len coded string]
@@ -603,13 +653,22 @@ func (p *packetRowData) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position
 	pos := 0
 	// Loop until end of packet
 	for {
+		// NULL column [0xfb]
+		if data[pos] == 0xfb {
+			p.row = append(p.row, nil)
+			pos++
+			if pos == len(data) {
+				break
+			}
+			continue
+		}
 		// Read string
 		b, n, err := p.readLengthCodedBytes(data[pos:])
 		if err != nil {
@@ -640,7 +699,7 @@ func (p *packetPrepareOK) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Position (skip first byte/field count)
@@ -662,7 +721,7 @@ func (p *packetPrepareOK) read(data []byte) (err os.Error) {
 // Parameter struct
 type packetParameter struct {
 	packetBase
-	paramType []byte
+	paramType uint8
 	flags     uint16
 	decimals  uint8
 	length    uint32
@@ -673,10 +732,32 @@ func (p *packetParameter) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
-	// Ignore packet for now
+	// Documented format, 9 bytes
+	if len(data) == 9 {
+		// Type [16 bit uint]
+		p.paramType = uint8(btoui16(data[0:2]))
+		// Flags [16 bit uint]
+		p.flags = btoui16(data[2:4])
+		// Decimals [8 bit uint]
+		p.decimals = data[4]
+		// Length [32 bit uint]
+		p.length = btoui32(data[5:9])
+		return
+	}
+	// MySQL 4.1+ actually sends a field packet for each parameter
+	f := new(packetField)
+	f.protocol = p.protocol
+	err = f.read(data)
+	if err != nil {
+		return
+	}
+	p.paramType = f.fieldType
+	p.flags = f.flags
+	p.decimals = f.decimals
+	p.length = f.length
 	return
 }
 
@@ -694,7 +775,7 @@ func (p *packetLongData) write() (data []byte, err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Make slice from command byte
@@ -728,7 +809,7 @@ func (p *packetExecute) write() (data []byte, err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Make slice from command byte
@@ -773,7 +854,7 @@ func (p *packetRowBinary) read(data []byte) (err os.Error) {
 	// Recover errors
 	defer func() {
 		if e := recover(); e != nil {
-			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR}
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
 		}
 	}()
 	// Simply store the row
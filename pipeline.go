@@ -0,0 +1,296 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Pipeline struct, queued commands are sent in a single write and the
+// responses are read in order
+type Pipeline struct {
+	c    *Client
+	cmds []*pipelineCmd
+}
+
+// Queued command, err is set if the command can't be sent. Statement
+// executes keep the bind generation of the params sent
+type pipelineCmd struct {
+	sql string
+	s   *Statement
+	gen uint64
+	p   packetWritable
+	err os.Error
+}
+
+// Result of a pipelined command, result sets are stored and must be freed
+type PipelineResult struct {
+	AffectedRows uint64
+	LastInsertId uint64
+	Warnings     uint16
+	Results      []*Result
+	Err          os.Error
+}
+
+// Create a new pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Queue a query
+func (p *Pipeline) Query(sql string) {
+	cmd := &pipelineCmd{sql: sql}
+	pkt := &packetCommand{
+		command: COM_QUERY,
+		args:    []interface{}{sql},
+	}
+	pkt.protocol = p.c.protocol
+	cmd.p = pkt
+	p.cmds = append(p.cmds, cmd)
+}
+
+// Queue a statement execute with the currently bound params, params can be
+// bound again for the next execute once queued
+func (p *Pipeline) Execute(s *Statement) {
+	cmd := &pipelineCmd{sql: s.preparedSql, s: s, gen: s.bindGen}
+	switch {
+	// Check prepared
+	case !s.prepared:
+		cmd.err = &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
+	// Check params bound
+	case s.paramCount > 0 && !s.paramsBound:
+		cmd.err = &ClientError{CR_PARAMS_NOT_BOUND, CR_PARAMS_NOT_BOUND_STR, nil}
+	default:
+		// Reader params are sent as separate commands so can't be pipelined
+		for k, r := range s.paramReaders {
+			if r != nil {
+				cmd.err = &ClientError{CR_UNSUPPORTED_PARAM_TYPE, p.c.fmtError(CR_UNSUPPORTED_PARAM_TYPE_STR, fmt.Sprintf("%T", r), k), nil}
+				break
+			}
+		}
+	}
+	if cmd.err == nil {
+		pkt := s.executePacket()
+		pkt.sequence = 0
+		cmd.p = pkt
+	}
+	p.cmds = append(p.cmds, cmd)
+}
+
+// Get the number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Send the queued commands and read the responses, a result is returned for
+// each command in the order queued. Server errors are returned per command
+// and don't stop the remaining commands. If the connection is lost the
+// remaining commands fail, commands are not run again after reconnecting
+// as they may have been applied
+func (p *Pipeline) Run() (results []*PipelineResult, err os.Error) {
+	c := p.c
+	cmds := p.cmds
+	p.cmds = nil
+	// Log pipeline
+	c.log(1, "=== Begin pipeline of %d commands ===", len(cmds))
+	// Lock client, a statement holding the lock can be pipelined
+	var owner interface{} = &lockToken{"pipeline"}
+	for _, cmd := range cmds {
+		if cmd.s != nil {
+			owner = cmd.s
+			break
+		}
+	}
+	err = c.acquire(owner, "pipeline")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	// Pre-run checks
+	if !c.checkConn() || c.pending() {
+		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	// Reset client
+	c.reset()
+	// Write all commands in a single write
+	results = make([]*PipelineResult, len(cmds))
+	var pkts []packetWritable
+	for i, cmd := range cmds {
+		results[i] = &PipelineResult{Err: cmd.err}
+		if cmd.err == nil {
+			pkts = append(pkts, cmd.p)
+		}
+	}
+	if len(pkts) == 0 {
+		return
+	}
+	c.lastUsed = time.Nanoseconds()
+	err = c.w.writePackets(pkts...)
+	if err != nil {
+		// None of the commands were sent, each fails with the write error
+		err = c.simpleReconnect(err)
+		for i, cmd := range cmds {
+			if cmd.err == nil {
+				results[i].Err = err
+			}
+		}
+		return results, nil
+	}
+	c.log(1, "Sent %d pipelined command packets", len(pkts))
+	// Read responses in order
+	for i, cmd := range cmds {
+		if cmd.err != nil {
+			continue
+		}
+		res := results[i]
+		// A failed response leaves the connection out of sync
+		if err != nil {
+			res.Err = err
+			continue
+		}
+		if cmd.s != nil {
+			res.Err = p.readExecute(cmd.s, cmd.gen, res)
+		} else {
+			res.Err = p.readQuery(cmd.sql, res)
+		}
+		if res.Err != nil {
+			if _, ok := res.Err.(*ServerError); !ok && !isStoreLimit(res.Err) {
+				err = res.Err
+			}
+		}
+	}
+	// Reconnect after a lost connection, the commands are not run again
+	if err != nil {
+		rcErr := c.simpleReconnect(err)
+		for _, res := range results {
+			if res.Err == err {
+				res.Err = rcErr
+			}
+		}
+		err = nil
+	}
+	return
+}
+
+// Read the response to a pipelined query, including any further results
+func (p *Pipeline) readQuery(sql string, res *PipelineResult) (err os.Error) {
+	c := p.c
+	// Each command starts a new sequence
+	c.reset()
+	c.lastSql = sql
+	for {
+		c.sequence++
+		_, err = c.getResult(PACKET_OK | PACKET_ERROR | PACKET_RESULT)
+		if sErr, ok := err.(*ServerError); ok {
+			sErr.Query = sql
+		}
+		if err != nil {
+			return
+		}
+		if c.result != nil {
+			// Store all rows and detach the result from the client
+			err = c.getFields()
+			if err == nil {
+				c.result.mode = RESULT_STORED
+				err = c.getAllRows()
+			}
+			r := c.result
+			c.result = nil
+			if err == nil {
+				err = storeDetached(r, res)
+			} else {
+				r.freeStore()
+			}
+			if err != nil {
+				return
+			}
+		} else {
+			res.AffectedRows = c.AffectedRows
+			res.LastInsertId = c.LastInsertId
+			res.Warnings = c.Warnings
+		}
+		if !c.MoreResults() {
+			break
+		}
+	}
+	return
+}
+
+// Read the response to a pipelined statement execute, gen is the bind
+// generation of the params sent
+func (p *Pipeline) readExecute(s *Statement, gen uint64, res *PipelineResult) (err os.Error) {
+	// Each command starts a new sequence
+	s.reset()
+	s.c.lastSql = s.preparedSql
+	for {
+		s.c.sequence++
+		_, err = s.getResult(PACKET_OK | PACKET_ERROR | PACKET_RESULT)
+		if sErr, ok := err.(*ServerError); ok {
+			sErr.Query = s.preparedSql
+		}
+		if err != nil {
+			return
+		}
+		// Params were sent with types, unless bound again since queued
+		if s.bindGen == gen {
+			s.paramsRebound = false
+		}
+		if s.result != nil {
+			// Store all rows and detach the result from the statement
+			err = s.getFields()
+			if err == nil {
+				s.result.mode = RESULT_STORED
+				err = s.getAllRows()
+			}
+			r := s.result
+			s.result = nil
+			if err == nil {
+				err = storeDetached(r, res)
+			} else {
+				r.freeStore()
+			}
+			if err != nil {
+				return
+			}
+		} else {
+			res.AffectedRows = s.AffectedRows
+			res.LastInsertId = s.LastInsertId
+			res.Warnings = s.Warnings
+		}
+		if !s.c.MoreResults() {
+			break
+		}
+	}
+	return
+}
+
+// Add a fully read result to a pipeline result, results exceeding the store
+// limits are freed
+func storeDetached(r *Result, res *PipelineResult) os.Error {
+	r.allRead = true
+	r.detached = true
+	if r.storeErr != nil {
+		err := r.storeErr
+		r.Free()
+		return err
+	}
+	res.Results = append(res.Results, r)
+	return nil
+}
+
+// Check if an error is a stored result limit, the result is read in full so
+// the connection is still in sync
+func isStoreLimit(err os.Error) bool {
+	if cErr, ok := err.(*ClientError); ok {
+		switch cErr.Errno {
+		case CR_RESULT_ROW_LIMIT, CR_RESULT_SIZE_LIMIT, CR_RESULT_SPILL_ERROR:
+			return true
+		}
+	}
+	return false
+}
@@ -13,8 +13,9 @@ import (
 
 // Packet reader struct
 type reader struct {
-	conn     io.ReadWriteCloser
-	protocol uint8
+	conn         io.ReadWriteCloser
+	protocol     uint8
+	sessionTrack bool
 }
 
 // Create a new reader
@@ -32,15 +33,15 @@ func (r *reader) readPacket(types packetType) (p packetReadable, err os.Error) {
 		if err != nil {
 			// EOF errors
 			if err == os.EOF || err == io.ErrUnexpectedEOF {
-				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR}
+				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, err}
 			}
 			// OpError
 			if _, ok := err.(*net.OpError); ok {
-				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR}
+				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, err}
 			}
 			// Not ClientError, unknown error
 			if _, ok := err.(*ClientError); !ok {
-				err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+				err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, err}
 			}
 		}
 	}()
@@ -61,66 +62,74 @@ func (r *reader) readPacket(types packetType) (p packetReadable, err os.Error) {
 		return
 	}
 	if nr != int(pktLen) {
-		err = &ClientError{CR_DATA_TRUNCATED, CR_DATA_TRUNCATED_STR}
+		err = &ClientError{CR_DATA_TRUNCATED, CR_DATA_TRUNCATED_STR, nil}
 	}
+	// Decode packet
+	return r.decodePacket(types, uint8(pktSeq), pktData)
+}
+
+// Decode packet data based on the expected types
+func (r *reader) decodePacket(types packetType, pktSeq uint8, pktData []byte) (p packetReadable, err os.Error) {
 	// Work out packet type
 	switch {
 	// Unknown packet
 	default:
-		err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+		err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 	// Initialisation / handshake packet, server > client
 	case types&PACKET_INIT != 0:
 		pk := new(packetInit)
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Ok packet
 	case types&PACKET_OK != 0 && pktData[0] == 0x0:
 		pk := new(packetOK)
 		pk.protocol = r.protocol
-		pk.sequence = uint8(pktSeq)
+		pk.sessionTrack = r.sessionTrack
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Error packet
 	case types&PACKET_ERROR != 0 && pktData[0] == 0xff:
 		pk := new(packetError)
 		pk.protocol = r.protocol
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// EOF packet
 	case types&PACKET_EOF != 0 && pktData[0] == 0xfe:
 		pk := new(packetEOF)
 		pk.protocol = r.protocol
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Result set packet
 	case types&PACKET_RESULT != 0 && pktData[0] > 0x0 && pktData[0] < 0xfe:
 		pk := new(packetResultSet)
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Field packet
 	case types&PACKET_FIELD != 0 && pktData[0] < 0xfe:
 		pk := new(packetField)
 		pk.protocol = r.protocol
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Row data packet
 	case types&PACKET_ROW != 0 && pktData[0] < 0xfe:
 		pk := new(packetRowData)
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Prepare ok packet
 	case types&PACKET_PREPARE_OK != 0 && pktData[0] == 0x0:
 		pk := new(packetPrepareOK)
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Param packet
 	case types&PACKET_PARAM != 0 && pktData[0] < 0xfe:
 		pk := new(packetParameter)
-		pk.sequence = uint8(pktSeq)
+		pk.protocol = r.protocol
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	// Binary row packet
 	case types&PACKET_ROW_BINARY != 0 && pktData[0] < 0xfe:
 		pk := new(packetRowBinary)
-		pk.sequence = uint8(pktSeq)
+		pk.sequence = pktSeq
 		return pk, pk.read(pktData)
 	}
 	return
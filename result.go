@@ -5,13 +5,22 @@
 // license that can be found in the LICENSE file.
 package mysql
 
-import "os"
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
 
 // Result struct
 type Result struct {
 	// Pointer to the client
 	c *Client
 
+	// Lock owner of the query, used to read and free the result
+	owner interface{}
+
 	// Fields
 	fieldCount uint64
 	fieldPos   uint64
@@ -22,25 +31,185 @@ type Result struct {
 	rows   []Row
 
 	// Storage
-	mode    byte
-	allRead bool
+	mode     byte
+	allRead  bool
+	size     uint64
+	spill    *spillFile
+	storeErr os.Error
+
+	// Result is not the current result of the client e.g. returned by a pipeline
+	detached bool
+
+	// Column index by name
+	columns map[string]int
 }
 
 // Field type
 type Field struct {
-	Database string
-	Table    string
-	Name     string
-	Length   uint32
-	Type     FieldType
-	Flags    FieldFlag
-	Decimals uint8
+	Catalog    string
+	Database   string
+	Table      string
+	OrgTable   string
+	Name       string
+	OrgName    string
+	Charset    uint16
+	Length     uint32
+	Type       FieldType
+	Flags      FieldFlag
+	Decimals   uint8
+	Default    string
+	HasDefault bool
+}
+
+// Check if the field is part of the primary key
+func (f *Field) IsPrimaryKey() bool {
+	return f.Flags&FLAG_PRI_KEY > 0
+}
+
+// Check if the field can be NULL
+func (f *Field) IsNullable() bool {
+	return f.Flags&FLAG_NOT_NULL == 0
+}
+
+// Check if the field is unsigned
+func (f *Field) IsUnsigned() bool {
+	return f.Flags&FLAG_UNSIGNED > 0
+}
+
+// Check if the field contains binary data, including text with a binary
+// collation (e.g. utf8_bin)
+func (f *Field) IsBinary() bool {
+	return f.Flags&FLAG_BINARY > 0 || f.Charset == CHARSET_BINARY
+}
+
+// Get the Go type used for values of the field in statement results
+func (f *Field) GoType() reflect.Type {
+	switch f.Type {
+	case FIELD_TYPE_TINY, FIELD_TYPE_SHORT, FIELD_TYPE_YEAR, FIELD_TYPE_INT24, FIELD_TYPE_LONG, FIELD_TYPE_LONGLONG:
+		if f.IsUnsigned() {
+			return reflect.TypeOf(uint64(0))
+		}
+		return reflect.TypeOf(int64(0))
+	case FIELD_TYPE_FLOAT:
+		return reflect.TypeOf(float32(0))
+	case FIELD_TYPE_DOUBLE:
+		return reflect.TypeOf(float64(0))
+	case FIELD_TYPE_DATE:
+		return reflect.TypeOf(Date{})
+	case FIELD_TYPE_TIME:
+		return reflect.TypeOf(Time{})
+	case FIELD_TYPE_DATETIME, FIELD_TYPE_TIMESTAMP:
+		return reflect.TypeOf(DateTime{})
+	case FIELD_TYPE_DECIMAL, FIELD_TYPE_NEWDECIMAL:
+		return reflect.TypeOf("")
+	case FIELD_TYPE_VARCHAR, FIELD_TYPE_VAR_STRING, FIELD_TYPE_STRING,
+		FIELD_TYPE_TINY_BLOB, FIELD_TYPE_MEDIUM_BLOB, FIELD_TYPE_LONG_BLOB, FIELD_TYPE_BLOB:
+		if !f.IsBinary() {
+			return reflect.TypeOf("")
+		}
+	}
+	return reflect.TypeOf([]byte(nil))
 }
 
 // Row types
 type Row []interface{}
 type Map map[string]interface{}
 
+// Assign row values to pointers, conversions are the same as Statement.BindResult
+func (r Row) Scan(dest ...interface{}) os.Error {
+	return scanRow(r, dest)
+}
+
+// Check if a column is NULL
+func (r Row) IsNull(i int) bool {
+	return i >= 0 && i < len(r) && r[i] == nil
+}
+
+// Get a column as an int64, NULL returns 0
+func (r Row) Int64(i int) (n int64, err os.Error) {
+	err = r.convert(i, func(v interface{}) {
+		n = int64(atoui64(v))
+	})
+	return
+}
+
+// Get a column as a uint64, NULL returns 0
+func (r Row) Uint64(i int) (n uint64, err os.Error) {
+	err = r.convert(i, func(v interface{}) {
+		n = atoui64(v)
+	})
+	return
+}
+
+// Get a column as a float64, NULL returns 0
+func (r Row) Float64(i int) (f float64, err os.Error) {
+	err = r.convert(i, func(v interface{}) {
+		f = atof64(v)
+	})
+	return
+}
+
+// Get a column as a string, NULL returns an empty string
+func (r Row) String(i int) (s string, err os.Error) {
+	err = r.convert(i, func(v interface{}) {
+		s = atos(v)
+	})
+	return
+}
+
+// Get a column as a byte slice, NULL returns nil
+func (r Row) Bytes(i int) (b []byte, err os.Error) {
+	err = r.convert(i, func(v interface{}) {
+		b = atob(v)
+	})
+	return
+}
+
+// Get a column as a DateTime, NULL returns the zero value
+func (r Row) Time(i int) (d DateTime, err os.Error) {
+	err = r.convert(i, func(v interface{}) {
+		switch v.(type) {
+		// Text protocol values
+		case []byte, string:
+			var e os.Error
+			s := atos(v)
+			if strings.Index(s, "-") == -1 {
+				var t Time
+				t, e = stotime(s)
+				d = atodt(t)
+			} else {
+				d, e = stodatetime(s)
+			}
+			if e != nil {
+				panic(e)
+			}
+		default:
+			d = atodt(v)
+		}
+	})
+	return
+}
+
+// Convert a column value, conversion panics are returned as errors
+func (r Row) convert(i int, fn func(v interface{})) (err os.Error) {
+	// Check column
+	if i < 0 || i >= len(r) {
+		return &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR, nil}
+	}
+	// NULL values return the zero value
+	if r[i] == nil {
+		return
+	}
+	// Recover type conversion errors
+	defer func() {
+		if e := recover(); e != nil {
+			err = &ClientError{CR_UNSUPPORTED_PARAM_TYPE, Error(fmt.Sprintf(string(CR_UNSUPPORTED_PARAM_TYPE_STR), fmt.Sprintf("%T", r[i]), i)), nil}
+		}
+	}()
+	fn(r[i])
+	return
+}
+
 // Get field count
 func (r *Result) FieldCount() uint64 {
 	return r.fieldCount
@@ -62,41 +231,194 @@ func (r *Result) FetchFields() []*Field {
 	return r.fields
 }
 
+// Get the current field position
+func (r *Result) FieldTell() uint64 {
+	return r.fieldPos
+}
+
+// Set the field position for FetchField, returns the previous position
+func (r *Result) FieldSeek(offset uint64) (prev uint64) {
+	prev = r.fieldPos
+	if offset > uint64(len(r.fields)) {
+		offset = uint64(len(r.fields))
+	}
+	r.fieldPos = offset
+	return
+}
+
+// Get the index of a column by name, -1 if the column doesn't exist
+func (r *Result) ColumnIndex(name string) int {
+	// Build index on first use, the first column wins for duplicate names
+	if r.columns == nil {
+		r.columns = make(map[string]int, len(r.fields))
+		for i := len(r.fields) - 1; i >= 0; i-- {
+			r.columns[r.fields[i].Name] = i
+		}
+	}
+	if i, ok := r.columns[name]; ok {
+		return i
+	}
+	return -1
+}
+
+// Check if a named column is NULL
+func (r *Result) IsNull(row Row, name string) bool {
+	return row.IsNull(r.ColumnIndex(name))
+}
+
+// Get a named column as an int64
+func (r *Result) Int64(row Row, name string) (int64, os.Error) {
+	return row.Int64(r.ColumnIndex(name))
+}
+
+// Get a named column as a uint64
+func (r *Result) Uint64(row Row, name string) (uint64, os.Error) {
+	return row.Uint64(r.ColumnIndex(name))
+}
+
+// Get a named column as a float64
+func (r *Result) Float64(row Row, name string) (float64, os.Error) {
+	return row.Float64(r.ColumnIndex(name))
+}
+
+// Get a named column as a string
+func (r *Result) String(row Row, name string) (string, os.Error) {
+	return row.String(r.ColumnIndex(name))
+}
+
+// Get a named column as a byte slice
+func (r *Result) Bytes(row Row, name string) ([]byte, os.Error) {
+	return row.Bytes(r.ColumnIndex(name))
+}
+
+// Get a named column as a DateTime
+func (r *Result) Time(row Row, name string) (DateTime, os.Error) {
+	return row.Time(r.ColumnIndex(name))
+}
+
 // Get row count
 func (r *Result) RowCount() uint64 {
 	// Stored mode
 	if r.mode == RESULT_STORED {
-		return uint64(len(r.rows))
+		return r.storedRows()
 	}
 	return 0
 }
 
+// Move to row n of a stored result, the first row is 0
+func (r *Result) DataSeek(n uint64) (err os.Error) {
+	_, err = r.RowSeek(n)
+	return
+}
+
+// Get the current row position of a stored result
+func (r *Result) RowTell() uint64 {
+	return r.rowPos
+}
+
+// Set the row position of a stored result using a value from RowTell,
+// returns the previous position
+func (r *Result) RowSeek(offset uint64) (prev uint64, err os.Error) {
+	// Stored results only
+	if r.mode != RESULT_STORED {
+		return 0, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	// Check position, seeking to the end is allowed
+	if offset > r.storedRows() {
+		return 0, &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR, nil}
+	}
+	prev = r.rowPos
+	r.rowPos = offset
+	return
+}
+
 // Fetch a row
 func (r *Result) FetchRow() Row {
+	row, _ := r.fetchRow()
+	return row
+}
+
+// Fetch the next row, nil is returned when all rows have been read
+func (r *Result) fetchRow() (row Row, err os.Error) {
+	switch r.mode {
 	// Stored result
-	if r.mode == RESULT_STORED {
+	case RESULT_STORED:
 		// Check if all rows have been fetched
-		if r.rowPos < uint64(len(r.rows)) {
+		if r.rowPos < r.storedRows() {
 			// Increment position and return current row
 			r.rowPos++
-			return r.rows[r.rowPos-1]
+			return r.storedRow(r.rowPos - 1)
 		}
-	}
 	// Used result
-	if r.mode == RESULT_USED {
+	case RESULT_USED:
 		if r.allRead == false {
-			eof, err := r.c.getRow()
+			// Check the result hasn't been freed
+			if r.c == nil {
+				return nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+			}
+			// Lock client
+			c := r.c
+			err := c.acquire(r.owner, "result")
 			if err != nil {
-				return nil
+				return nil, err
+			}
+			defer c.unlock()
+			eof, err := c.getRow()
+			if err != nil {
+				return nil, err
 			}
 			if eof {
 				r.allRead = true
 			} else {
-				return r.rows[0]
+				return r.rows[0], nil
 			}
 		}
+	// Result not stored or used
+	default:
+		return nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
-	return nil
+	return
+}
+
+// Fetch a row streaming column col, the rest of the row is set once the reader
+// returns EOF with the streamed column set to its length, reader is nil for NULL
+func (r *Result) FetchRowReader(col int) (row Row, rd io.Reader, err os.Error) {
+	// Only used results can be streamed
+	if r.mode != RESULT_USED {
+		return nil, nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	if r.allRead {
+		return
+	}
+	// Check the result hasn't been freed
+	if r.c == nil {
+		return nil, nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	// Lock client
+	c := r.c
+	err = c.acquire(r.owner, "result")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	eof, row, rd, err := c.getRowStream(r, col, false, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if eof {
+		r.allRead = true
+	}
+	return
+}
+
+// Fetch a row copying column col to w
+func (r *Result) FetchRowWriter(col int, w io.Writer) (row Row, n int64, err os.Error) {
+	row, rd, err := r.FetchRowReader(col)
+	if err != nil || rd == nil {
+		return
+	}
+	n, err = io.Copy(w, rd)
+	return
 }
 
 // Fetch a map
@@ -116,6 +438,18 @@ func (r *Result) FetchMap() Map {
 // Fetch all rows
 func (r *Result) FetchRows() []Row {
 	if r.mode == RESULT_STORED {
+		// Rows written to a temporary file are read back into memory
+		if r.spill != nil {
+			rows := make([]Row, r.storedRows())
+			for i := range rows {
+				row, err := r.storedRow(uint64(i))
+				if err != nil {
+					return nil
+				}
+				rows[i] = row
+			}
+			return rows
+		}
 		return r.rows
 	}
 	return nil
@@ -123,6 +457,25 @@ func (r *Result) FetchRows() []Row {
 
 // Free the result
 func (r *Result) Free() (err os.Error) {
-	err = r.c.FreeResult()
-	return
+	// Detached results are already fully read
+	if r.detached {
+		r.freeStore()
+		r.fields = nil
+		r.columns = nil
+		r.rowPos = 0
+		r.mode = RESULT_FREE
+		return
+	}
+	// Check the result hasn't been freed
+	if r.c == nil {
+		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	// Lock client
+	c := r.c
+	err = c.acquire(r.owner, "result")
+	if err != nil {
+		return
+	}
+	defer c.unlock()
+	return c.freeResult()
 }
@@ -0,0 +1,186 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"os"
+	"rand"
+	"time"
+)
+
+// Retry policy struct, delays are in nanoseconds
+type RetryPolicy struct {
+	// Maximum number of retries after the first attempt
+	MaxRetries int
+
+	// Delay before the first retry, multiplied for each further retry up to MaxDelay
+	Delay      int64
+	MaxDelay   int64
+	Multiplier float64
+
+	// Random fraction of the delay added or removed (0 - 1)
+	Jitter float64
+}
+
+// Default retry policy, used when Client.RetryPolicy is nil
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	Delay:      10000000,
+	MaxDelay:   1000000000,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Get the delay before retry number n (starting at 0)
+func (p *RetryPolicy) delay(n int) int64 {
+	return backoff(p.Delay, p.MaxDelay, p.Multiplier, p.Jitter, n)
+}
+
+// Reconnect policy struct, delays are in nanoseconds
+type ReconnectPolicy struct {
+	// Maximum number of connection attempts
+	MaxAttempts int
+
+	// Delay after the first failed attempt, multiplied for each further attempt up to MaxDelay
+	Delay      int64
+	MaxDelay   int64
+	Multiplier float64
+
+	// Random fraction of the delay added or removed (0 - 1)
+	Jitter float64
+
+	// Reconnecting stops when a value is received or the channel is closed
+	Cancel <-chan bool
+
+	// Called after each attempt, err is nil if the attempt succeeded
+	OnReconnect func(attempt int, err os.Error)
+}
+
+// Default reconnect policy, used when Client.ReconnectPolicy is nil
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MaxAttempts: 10,
+	Delay:       2000000000,
+	Multiplier:  1,
+}
+
+// Get the delay after failed attempt number n (starting at 0)
+func (p *ReconnectPolicy) delay(n int) int64 {
+	return backoff(p.Delay, p.MaxDelay, p.Multiplier, p.Jitter, n)
+}
+
+// Wait before the next attempt, returns false if cancelled
+func (p *ReconnectPolicy) wait(d int64) bool {
+	if p.Cancel == nil {
+		time.Sleep(d)
+		return true
+	}
+	select {
+	case <-p.Cancel:
+		return false
+	case <-time.After(d):
+	}
+	return true
+}
+
+// Check if reconnecting has been cancelled
+func (p *ReconnectPolicy) cancelled() bool {
+	return isCancelled(p.Cancel)
+}
+
+// Calculate an exponential backoff delay for attempt n (starting at 0)
+func backoff(delay, maxDelay int64, multiplier, jitter float64, n int) int64 {
+	d := float64(delay)
+	for i := 0; i < n; i++ {
+		d *= multiplier
+		if maxDelay > 0 && d > float64(maxDelay) {
+			break
+		}
+	}
+	if maxDelay > 0 && d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if jitter > 0 {
+		d += d * jitter * (2*rand.Float64() - 1)
+	}
+	return int64(d)
+}
+
+// Check if an error is transient and the failed operation can be retried.
+// Deadlocks, lock wait timeouts, writes to a read only server (e.g. during a
+// failover) and too many connections are retryable
+func IsRetryable(err os.Error) bool {
+	sErr, ok := AsServerError(err)
+	if !ok {
+		return false
+	}
+	switch sErr.Errno {
+	case ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT, ER_OPTION_PREVENTS_STATEMENT,
+		ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION, ER_CON_COUNT_ERROR:
+		return true
+	}
+	return false
+}
+
+// Get the retry policy for the client
+func (c *Client) retryPolicy() *RetryPolicy {
+	if c.RetryPolicy != nil {
+		return c.RetryPolicy
+	}
+	return &DefaultRetryPolicy
+}
+
+// Get the reconnect policy for the client
+func (c *Client) reconnectPolicy() *ReconnectPolicy {
+	if c.ReconnectPolicy != nil {
+		return c.ReconnectPolicy
+	}
+	return &DefaultReconnectPolicy
+}
+
+// Run fn in a transaction, the transaction is committed if fn returns nil and
+// rolled back otherwise. If fn or the commit fails with a retryable error the
+// whole transaction is run again according to the retry policy. Any result
+// sets must be freed before fn returns
+func (c *Client) RunInTransaction(fn func() os.Error) (err os.Error) {
+	// Log run in transaction
+	c.log(1, "=== Begin run in transaction ===")
+	p := c.retryPolicy()
+	for i := 0; ; i++ {
+		err = c.runTransaction(fn)
+		if err == nil || !IsRetryable(err) || i >= p.MaxRetries {
+			return
+		}
+		d := p.delay(i)
+		c.log(1, "Retrying transaction in %dms after error: %s", d/1000000, err)
+		time.Sleep(d)
+	}
+	return
+}
+
+// Run a single attempt of a transaction
+func (c *Client) runTransaction(fn func() os.Error) (err os.Error) {
+	tx, err := c.Begin()
+	if err != nil {
+		return
+	}
+	// Rollback on panic
+	defer func() {
+		if e := recover(); e != nil {
+			tx.Rollback()
+			panic(e)
+		}
+	}()
+	err = fn()
+	if err != nil {
+		// Free any unfreed result so rollback can be sent
+		if c.checkResult() {
+			c.FreeResult()
+		}
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
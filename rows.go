@@ -0,0 +1,107 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import "os"
+
+// Rows struct, iterates a result set reporting errors separately from the
+// end of the rows
+type Rows struct {
+	// Fetch and free functions
+	fetch func() (Row, os.Error)
+	free  func() os.Error
+
+	// Fields, read when requested as statements may not have a result yet
+	fields func() []*Field
+
+	// Current row and state
+	row    Row
+	err    os.Error
+	closed bool
+}
+
+// Get a row iterator for a stored or used result
+func (r *Result) Rows() *Rows {
+	return &Rows{
+		fetch: func() (Row, os.Error) {
+			return r.fetchRow()
+		},
+		free: func() os.Error {
+			return r.Free()
+		},
+		fields: func() []*Field {
+			return r.fields
+		},
+	}
+}
+
+// Get a row iterator for the statement result
+func (s *Statement) Rows() *Rows {
+	return &Rows{
+		fetch: func() (row Row, err os.Error) {
+			// Auto reconnect
+			defer func() {
+				err = s.c.simpleReconnect(err)
+			}()
+			_, row, err = s.fetchRow()
+			return
+		},
+		free: func() os.Error {
+			return s.FreeResult()
+		},
+		fields: func() []*Field {
+			if s.checkResult() {
+				return s.result.fields
+			}
+			return nil
+		},
+	}
+}
+
+// Move to the next row, returns false at the end of the rows or on error
+func (r *Rows) Next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+	r.row, r.err = r.fetch()
+	if r.err != nil {
+		r.row = nil
+	}
+	return r.row != nil
+}
+
+// Get the current row
+func (r *Rows) Row() Row {
+	return r.row
+}
+
+// Get the fields for the rows
+func (r *Rows) Fields() []*Field {
+	return r.fields()
+}
+
+// Assign the current row values to pointers, conversions are the same as Statement.BindResult
+func (r *Rows) Scan(dest ...interface{}) os.Error {
+	if r.row == nil {
+		return &ClientError{CR_NO_DATA, CR_NO_DATA_STR, nil}
+	}
+	return scanRow(r.row, dest)
+}
+
+// Get the error that ended the iteration, nil if all rows were read
+func (r *Rows) Err() os.Error {
+	return r.err
+}
+
+// Free the result, any unread rows are discarded
+func (r *Rows) Close() (err os.Error) {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.row = nil
+	return r.free()
+}
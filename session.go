@@ -0,0 +1,132 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Session variable set with SetVariable
+type sessionVar struct {
+	name  string
+	value string
+}
+
+// Set a session variable, the variable is set again if the client reconnects
+func (c *Client) SetVariable(name string, value interface{}) (err os.Error) {
+	// Log set variable
+	c.log(1, "=== Begin set variable '%s' ===", name)
+	// Check name, names can't be escaped so must be plain identifiers
+	if !isVariableName(name) {
+		return &ClientError{CR_INVALID_VARIABLE_NAME, c.fmtError(CR_INVALID_VARIABLE_NAME_STR, name), nil}
+	}
+	// Format value
+	var v string
+	switch t := value.(type) {
+	case nil:
+		v = "NULL"
+	case bool:
+		if t {
+			v = "1"
+		} else {
+			v = "0"
+		}
+	case string:
+		v = "'" + c.Escape(t) + "'"
+	case []byte:
+		v = "'" + c.Escape(string(t)) + "'"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		v = fmt.Sprint(t)
+	default:
+		return &ClientError{CR_UNSUPPORTED_PARAM_TYPE, c.fmtError(CR_UNSUPPORTED_PARAM_TYPE_STR, fmt.Sprintf("%T", value), 0), nil}
+	}
+	err = c.QueryIdempotent("SET SESSION " + name + "=" + v)
+	if err != nil {
+		return
+	}
+	// Store for reconnect
+	for i := range c.sessionVars {
+		if strings.ToLower(c.sessionVars[i].name) == strings.ToLower(name) {
+			c.sessionVars[i].value = v
+			return
+		}
+	}
+	c.sessionVars = append(c.sessionVars, sessionVar{name, v})
+	return
+}
+
+// Check a variable name only contains letters, digits, underscores and dots
+// with an optional @@ prefix
+func isVariableName(name string) bool {
+	if strings.HasPrefix(name, "@@") {
+		name = name[2:]
+	}
+	if len(name) == 0 {
+		return false
+	}
+	for _, ch := range name {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '_', ch == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Add a prepared statement to be prepared again on reconnect
+func (c *Client) addStmt(s *Statement) {
+	for _, stmt := range c.stmts {
+		if stmt == s {
+			return
+		}
+	}
+	c.stmts = append(c.stmts, s)
+}
+
+// Remove a closed statement
+func (c *Client) removeStmt(s *Statement) {
+	for i, stmt := range c.stmts {
+		if stmt == s {
+			c.stmts = append(c.stmts[:i], c.stmts[i+1:]...)
+			return
+		}
+	}
+}
+
+// Restore the session after reconnecting, the database and charset are set
+// during connect. Session variables are set again and prepared statements
+// are prepared again, getting new statement ids
+func (c *Client) restoreSession() (err os.Error) {
+	// Log restore session
+	c.log(1, "=== Begin restore session ===")
+	// Don't reconnect while restoring
+	c.restoring = true
+	defer func() {
+		c.restoring = false
+	}()
+	// Session variables
+	if len(c.sessionVars) > 0 {
+		vars := make([]string, len(c.sessionVars))
+		for i, v := range c.sessionVars {
+			vars[i] = v.name + "=" + v.value
+		}
+		err = c.query("SET SESSION "+strings.Join(vars, ", "), false)
+		if err != nil {
+			return
+		}
+	}
+	// Prepared statements
+	for _, s := range c.stmts {
+		err = s.reprepare()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
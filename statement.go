@@ -6,6 +6,9 @@
 package mysql
 
 import (
+	"fmt"
+	"io"
+	"mysql/geometry"
 	"os"
 	"reflect"
 	"strconv"
@@ -22,17 +25,26 @@ type Statement struct {
 	paramsBound   bool
 	paramsRebound bool
 
+	// Incremented each time params must be sent with types, pipelined
+	// executes only unflag params rebound if there has been no change since
+	bindGen uint64
+
 	// Statement id
 	statementId uint32
 
 	// Params
-	paramCount uint16
-	paramType  [][]byte
-	paramData  [][]byte
+	paramCount   uint16
+	params       []*Param
+	paramType    [][]byte
+	paramData    [][]byte
+	paramReaders []io.Reader
 
 	// Columns (fields)
 	columnCount uint64
 
+	// Set if the statement is safe to execute again after a lost connection
+	Idempotent bool
+
 	// Result
 	AffectedRows uint64
 	LastInsertId uint64
@@ -41,27 +53,46 @@ type Statement struct {
 	resultParams []interface{}
 }
 
+// Parameter metadata
+type Param struct {
+	Type     FieldType
+	Flags    FieldFlag
+	Length   uint32
+	Decimals uint8
+}
+
 // Prepare new statement
 func (s *Statement) Prepare(sql string) (err os.Error) {
-	// Auto reconnect
+	// Lock client until the statement is closed
+	err = s.c.acquire(s, "statement '"+sql+"'")
+	if err != nil {
+		return
+	}
 	defer func() {
-		if err != nil && s.c.checkNet(err) && s.c.Reconnect {
-			s.c.log(1, "!!! Lost connection to server !!!")
-			s.c.connected = false
-			err = s.c.reconnect()
-			if err == nil {
-				err = s.Prepare(sql)
-			}
+		if !s.prepared {
+			s.c.release(s)
 		}
 	}()
+	return s.prepare(sql)
+}
+
+// Prepare statement, sent again on reconnect
+func (s *Statement) prepare(sql string) (err os.Error) {
+	// Auto reconnect
+	defer func() {
+		err = s.c.safeReconnect(err, true, func() os.Error {
+			return s.prepare(sql)
+		})
+	}()
 	// Log prepare
 	s.c.log(1, "=== Begin prepare '%s' ===", sql)
 	// Pre-run checks
 	if !s.c.checkConn() || s.checkResult() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Reset client
 	s.reset()
+	s.params = nil
 	// Send close command
 	err = s.c.command(COM_STMT_PREPARE, sql)
 	if err != nil {
@@ -70,6 +101,9 @@ func (s *Statement) Prepare(sql string) (err os.Error) {
 	// Read result from server
 	s.c.sequence++
 	_, err = s.getResult(PACKET_PREPARE_OK | PACKET_ERROR)
+	if sErr, ok := err.(*ServerError); ok {
+		sErr.Query = sql
+	}
 	if err != nil {
 		return
 	}
@@ -96,6 +130,29 @@ func (s *Statement) Prepare(sql string) (err os.Error) {
 	// Statement is preapred
 	s.prepared = true
 	s.preparedSql = sql
+	// Store for reconnect
+	s.c.addStmt(s)
+	return
+}
+
+// Prepare the statement again after reconnecting, bound params and results
+// are kept
+func (s *Statement) reprepare() (err os.Error) {
+	// Discard any result from the lost connection
+	if s.result != nil {
+		s.result.freeStore()
+		s.result = nil
+	}
+	s.prepared = false
+	err = s.prepare(s.preparedSql)
+	if err != nil {
+		return
+	}
+	// Params must be sent with types on the next execute
+	if s.paramsBound {
+		s.paramsRebound = true
+		s.bindGen++
+	}
 	return
 }
 
@@ -104,29 +161,72 @@ func (s *Statement) ParamCount() uint16 {
 	return s.paramCount
 }
 
+// Get param metadata, nil if not sent by the server
+func (s *Statement) ParamMetadata() []*Param {
+	return s.params
+}
+
 // Bind params
 func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Check number of params is correct
 	if len(params) != int(s.paramCount) {
-		return &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR}
+		return &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR, nil}
 	}
 	// Reset params
 	s.paramType = [][]byte{}
 	s.paramData = [][]byte{}
+	s.paramReaders = make([]io.Reader, len(params))
 	// Convert params into bytes
 	for k, param := range params {
 		// Temp vars
 		var t FieldType
 		var d []byte
+		var u bool
+		// Convert custom types
+		param, err = convertParam(param)
+		if err != nil {
+			return
+		}
+		// Readers are sent as long data by Execute
+		if r, ok := param.(io.Reader); ok {
+			s.paramType = append(s.paramType, []byte{byte(FIELD_TYPE_BLOB), 0x0})
+			s.paramData = append(s.paramData, nil)
+			s.paramReaders[k] = r
+			continue
+		}
+		// Dereference pointers, nil pointers are NULL
+		for v := reflect.ValueOf(param); v.Kind() == reflect.Ptr; v = v.Elem() {
+			if v.IsNil() {
+				param = nil
+				break
+			}
+			param = v.Elem().Interface()
+		}
+		// Convert to the type expected by the server
+		if k < len(s.params) {
+			v, ok := coerceParam(param, s.params[k])
+			if !ok {
+				return &ClientError{CR_UNSUPPORTED_PARAM_TYPE, s.c.fmtError(CR_UNSUPPORTED_PARAM_TYPE_STR, fmt.Sprintf("%s for %s", reflect.TypeOf(param), s.params[k].Type), k), nil}
+			}
+			param = v
+		}
 		// Switch on type
 		switch param.(type) {
 		// Nil
 		case nil:
 			t = FIELD_TYPE_NULL
+		// Bool
+		case bool:
+			t = FIELD_TYPE_TINY
+			if param.(bool) {
+				d = []byte{0x1}
+			} else {
+				d = []byte{0x0}
+			}
 		// Int
 		case int:
 			if strconv.IntSize == 32 {
@@ -143,6 +243,7 @@ func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 				t = FIELD_TYPE_LONGLONG
 			}
 			d = uitob(param.(uint))
+			u = true
 		// Int8
 		case int8:
 			t = FIELD_TYPE_TINY
@@ -151,6 +252,7 @@ func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 		case uint8:
 			t = FIELD_TYPE_TINY
 			d = []byte{param.(uint8)}
+			u = true
 		// Int16
 		case int16:
 			t = FIELD_TYPE_SHORT
@@ -159,6 +261,7 @@ func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 		case uint16:
 			t = FIELD_TYPE_SHORT
 			d = ui16tob(param.(uint16))
+			u = true
 		// Int32
 		case int32:
 			t = FIELD_TYPE_LONG
@@ -167,6 +270,7 @@ func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 		case uint32:
 			t = FIELD_TYPE_LONG
 			d = ui32tob(param.(uint32))
+			u = true
 		// Int64
 		case int64:
 			t = FIELD_TYPE_LONGLONG
@@ -175,6 +279,7 @@ func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 		case uint64:
 			t = FIELD_TYPE_LONGLONG
 			d = ui64tob(param.(uint64))
+			u = true
 		// Float32
 		case float32:
 			t = FIELD_TYPE_FLOAT
@@ -193,22 +298,55 @@ func (s *Statement) BindParams(params ...interface{}) (err os.Error) {
 			t = FIELD_TYPE_BLOB
 			d = lcbtob(uint64(len(param.([]byte))))
 			d = append(d, param.([]byte)...)
+		// Date/time types, sent in MYSQL_TIME format
+		case Date:
+			t = FIELD_TYPE_DATE
+			d = datetob(param.(Date))
+		case Time:
+			t = FIELD_TYPE_TIME
+			d = timetob(param.(Time))
+		case DateTime:
+			t = FIELD_TYPE_DATETIME
+			d = datetimetob(param.(DateTime))
+		// Spatial value, sent in MySQL internal format
+		case geometry.Value:
+			t = FIELD_TYPE_BLOB
+			v := param.(geometry.Value)
+			g := v.Encode()
+			d = lcbtob(uint64(len(g)))
+			d = append(d, g...)
+		// Spatial type without SRID
+		case geometry.Geometry:
+			t = FIELD_TYPE_BLOB
+			g := (&geometry.Value{Geometry: param.(geometry.Geometry)}).Encode()
+			d = lcbtob(uint64(len(g)))
+			d = append(d, g...)
 		// Other types
 		default:
-			return &ClientError{CR_UNSUPPORTED_PARAM_TYPE, s.c.fmtError(CR_UNSUPPORTED_PARAM_TYPE_STR, reflect.ValueOf(param).Type(), k)}
+			return &ClientError{CR_UNSUPPORTED_PARAM_TYPE, s.c.fmtError(CR_UNSUPPORTED_PARAM_TYPE_STR, reflect.ValueOf(param).Type(), k), nil}
+		}
+		// Append values, second type byte is the unsigned flag
+		if u {
+			s.paramType = append(s.paramType, []byte{byte(t), 0x80})
+		} else {
+			s.paramType = append(s.paramType, []byte{byte(t), 0x0})
 		}
-		// Append values
-		s.paramType = append(s.paramType, []byte{byte(t), 0x0})
 		s.paramData = append(s.paramData, d)
 	}
 	// Flag params as bound
 	s.paramsBound = true
 	s.paramsRebound = true
+	s.bindGen++
 	return
 }
 
 // Send long data
 func (s *Statement) SendLongData(num int, data []byte) (err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
@@ -217,11 +355,11 @@ func (s *Statement) SendLongData(num int, data []byte) (err os.Error) {
 	s.c.log(1, "=== Begin send long data ===")
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Pre-run checks
 	if !s.c.checkConn() || s.checkResult() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Reset client
 	s.reset()
@@ -229,89 +367,130 @@ func (s *Statement) SendLongData(num int, data []byte) (err os.Error) {
 	pos := 0
 	// Send data
 	for {
-		// Construct packet
-		p := &packetLongData{
-			command:     uint8(COM_STMT_SEND_LONG_DATA),
-			statementId: s.statementId,
-			paramNumber: uint16(num),
-		}
-		// Add protocol and sequence
-		p.protocol = s.c.protocol
-		p.sequence = s.c.sequence
-		// Add data
-		if len(data[pos:]) > MAX_PACKET_SIZE-12 {
-			p.data = data[pos : MAX_PACKET_SIZE-12]
-			pos += MAX_PACKET_SIZE - 12
-		} else {
-			p.data = data[pos:]
-			pos += len(data[pos:])
+		// Get next chunk
+		end := len(data)
+		if end-pos > MAX_PACKET_SIZE-12 {
+			end = pos + MAX_PACKET_SIZE - 12
 		}
-		// Write packet
-		err = s.c.w.writePacket(p)
+		// Send packet
+		err = s.sendLongData(num, data[pos:end])
 		if err != nil {
 			return
 		}
-		// Log write success
-		s.c.log(1, "[%d] Sent long data packet", p.sequence)
+		pos = end
 		// Check if all data sent
 		if pos == len(data) {
 			break
 		}
-		// Increment sequence
-		s.c.sequence++
 	}
 	return
 }
 
-// Execute
-func (s *Statement) Execute() (err os.Error) {
+// Send long data from a reader in chunks of chunkSize bytes, if chunkSize is
+// 0 or less the maximum packet size is used
+func (s *Statement) SendLongDataReader(num int, r io.Reader, chunkSize int) (err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
-		if err != nil && s.c.checkNet(err) && s.c.Reconnect {
-			s.c.log(1, "!!! Lost connection to server !!!")
-			s.c.connected = false
-			err = s.c.reconnect()
-			if err == nil {
-				err = s.Prepare(s.preparedSql)
-				if err == nil {
-					err = s.Execute()
-				}
+		err = s.c.simpleReconnect(err)
+	}()
+	// Log send long data
+	s.c.log(1, "=== Begin send long data from reader ===")
+	// Check prepared
+	if !s.prepared {
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
+	}
+	// Pre-run checks
+	if !s.c.checkConn() || s.checkResult() {
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	// Reset client
+	s.reset()
+	// Send data
+	return s.sendLongDataReader(num, r, chunkSize)
+}
+
+// Send long data from a reader without locking or reconnecting, used by
+// SendLongDataReader and Execute
+func (s *Statement) sendLongDataReader(num int, r io.Reader, chunkSize int) (err os.Error) {
+	// Check chunk size
+	if chunkSize <= 0 || chunkSize > MAX_PACKET_SIZE-12 {
+		chunkSize = MAX_PACKET_SIZE - 12
+	}
+	// Send data, at least 1 packet is sent for empty readers
+	buf := make([]byte, chunkSize)
+	for sent := false; ; sent = true {
+		// Read next chunk
+		n, rErr := io.ReadFull(r, buf)
+		if rErr != nil && rErr != os.EOF && rErr != io.ErrUnexpectedEOF {
+			return rErr
+		}
+		// Send packet
+		if n > 0 || !sent {
+			err = s.sendLongData(num, buf[:n])
+			if err != nil {
+				return
 			}
 		}
+		// Check if all data sent
+		if rErr != nil {
+			break
+		}
+	}
+	return
+}
+
+// Execute
+func (s *Statement) Execute() (err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
+	// Auto reconnect, only read or idempotent statements are executed again,
+	// reader params are consumed so can't be sent again
+	readers := s.hasReaders()
+	defer func() {
+		safe := (s.Idempotent || isReadQuery(s.preparedSql)) && !readers
+		err = s.c.safeReconnect(err, safe, func() os.Error {
+			return s.Execute()
+		})
 	}()
 	// Log execute
 	s.c.log(1, "=== Begin execute ===")
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Check params bound
 	if s.paramCount > 0 && !s.paramsBound {
-		return &ClientError{CR_PARAMS_NOT_BOUND, CR_PARAMS_NOT_BOUND_STR}
+		return &ClientError{CR_PARAMS_NOT_BOUND, CR_PARAMS_NOT_BOUND_STR, nil}
 	}
 	// Pre-run checks
 	if !s.c.checkConn() || s.checkResult() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	// Stream reader params, readers can only be read once so must be bound again
+	for k, r := range s.paramReaders {
+		if r == nil {
+			continue
+		}
+		err = s.sendLongDataReader(k, r, 0)
+		if err != nil {
+			return
+		}
+		s.paramReaders[k] = nil
+		s.paramsBound = false
 	}
 	// Reset client
 	s.reset()
 	// Construct packet
-	p := &packetExecute{
-		command:        byte(COM_STMT_EXECUTE),
-		statementId:    s.statementId,
-		flags:          byte(CURSOR_TYPE_NO_CURSOR),
-		iterationCount: 1,
-		nullBitMap:     s.getNullBitMap(),
-		paramType:      s.paramType,
-		paramData:      s.paramData,
-	}
-	// Add protocol and sequence
-	p.protocol = s.c.protocol
-	p.sequence = s.c.sequence
-	// Add rebound flag
-	if s.paramsRebound {
-		p.newParamsBound = byte(1)
-	}
+	p := s.executePacket()
+	s.c.lastSql = s.preparedSql
 	// Write packet
 	err = s.c.w.writePacket(p)
 	if err != nil {
@@ -361,6 +540,14 @@ func (s *Statement) FetchColumns() []*Field {
 	return nil
 }
 
+// Get the index of a column by name, -1 if the column doesn't exist
+func (s *Statement) ColumnIndex(name string) int {
+	if s.checkResult() {
+		return s.result.ColumnIndex(name)
+	}
+	return -1
+}
+
 // Bind result
 func (s *Statement) BindResult(params ...interface{}) (err os.Error) {
 	s.resultParams = params
@@ -371,109 +558,181 @@ func (s *Statement) BindResult(params ...interface{}) (err os.Error) {
 func (s *Statement) RowCount() uint64 {
 	// Stored mode
 	if s.checkResult() && s.result.mode == RESULT_STORED {
-		return uint64(len(s.result.rows))
+		return s.result.storedRows()
 	}
 	return 0
 }
 
 // Fetch next row 
 func (s *Statement) Fetch() (eof bool, err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
 	}()
 	// Log fetch
 	s.c.log(1, "=== Begin fetch ===")
+	// Get next row
+	eof, row, err := s.fetchRow()
+	if err != nil || eof {
+		return
+	}
+	// Assign row values to the bound result pointers
+	err = scanRow(row, s.resultParams)
+	return
+}
+
+// Get the next row from the result
+func (s *Statement) fetchRow() (eof bool, row Row, err os.Error) {
 	// Check prepared
 	if !s.prepared {
-		return false, &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return false, nil, &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Check result
 	if !s.checkResult() {
-		return false, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return false, nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
 	}
-	var row Row
 	// Check result mode
 	switch s.result.mode {
 	// Used or unused result (needs fetching)
 	case RESULT_UNUSED, RESULT_USED:
 		s.result.mode = RESULT_USED
 		if s.result.allRead == true {
-			return true, nil
+			return true, nil, nil
 		}
-		eof, err := s.getRow()
+		eof, err = s.getRow()
 		if err != nil {
-			return false, err
+			return false, nil, err
 		}
 		if eof {
 			s.result.allRead = true
-			return true, nil
+			return true, nil, nil
 		}
 		row = s.result.rows[0]
 	// Stored result
 	case RESULT_STORED:
-		if s.result.rowPos >= uint64(len(s.result.rows)) {
-			return true, nil
+		if s.result.rowPos >= s.result.storedRows() {
+			return true, nil, nil
+		}
+		row, err = s.result.storedRow(s.result.rowPos)
+		if err != nil {
+			return false, nil, err
 		}
-		row = s.result.rows[s.result.rowPos]
 		s.result.rowPos++
 	}
-	// Recover possible errors from type conversion
+	return
+}
+
+// Fetch next row streaming column col, bound results are set once the reader
+// returns EOF and the streamed column is not assigned, reader is nil for NULL
+func (s *Statement) FetchReader(col int) (eof bool, rd io.Reader, err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
+	// Auto reconnect
 	defer func() {
-		if e := recover(); e != nil {
-			err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
-			return
-		}
+		err = s.c.simpleReconnect(err)
 	}()
-	// Iterate bound params and assign from row (partial set quicker this way)
-	for k, v := range s.resultParams {
-		switch t := v.(type) {
-		// Integer types
-		case *int:
-			*t = int(atoui64(row[k]))
-		case *uint:
-			*t = uint(atoui64(row[k]))
-		case *int8:
-			*t = int8(atoui64(row[k]))
-		case *uint8:
-			*t = uint8(atoui64(row[k]))
-		case *int16:
-			*t = int16(atoui64(row[k]))
-		case *uint16:
-			*t = uint16(atoui64(row[k]))
-		case *int32:
-			*t = int32(atoui64(row[k]))
-		case *uint32:
-			*t = uint32(atoui64(row[k]))
-		case *int64:
-			*t = int64(atoui64(row[k]))
-		case *uint64:
-			*t = atoui64(row[k])
-		// Floating point types
-		case *float32:
-			*t = float32(atof64(row[k]))
-		case *float64:
-			*t = atof64(row[k])
-		// Byte slice, assertion
-		case *[]byte:
-			*t = row[k].([]byte)
-		// Strings
-		case *string:
-			*t = atos(row[k])
-		// Date/time, assertion
-		case *Date:
-			*t = row[k].(Date)
-		case *Time:
-			*t = row[k].(Time)
-		case *DateTime:
-			*t = row[k].(DateTime)
-		}
+	// Log fetch
+	s.c.log(1, "=== Begin fetch reader ===")
+	// Check prepared
+	if !s.prepared {
+		return false, nil, &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
+	}
+	// Check result
+	if !s.checkResult() {
+		return false, nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	// Only unstored results can be streamed
+	if s.result.mode == RESULT_STORED {
+		return false, nil, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	s.result.mode = RESULT_USED
+	if s.result.allRead == true {
+		return true, nil, nil
+	}
+	// Skip the streamed column when assigning bound results
+	dest := make([]interface{}, len(s.resultParams))
+	copy(dest, s.resultParams)
+	if col >= 0 && col < len(dest) {
+		dest[col] = nil
+	}
+	eof, _, rd, err = s.c.getRowStream(s.result, col, true, func(row Row) os.Error {
+		return scanRow(row, dest)
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	if eof {
+		s.result.allRead = true
+	}
+	return
+}
+
+// Fetch next row copying column col to w
+func (s *Statement) FetchWriter(col int, w io.Writer) (eof bool, n int64, err os.Error) {
+	eof, rd, err := s.FetchReader(col)
+	if err != nil || rd == nil {
+		return
 	}
+	n, err = io.Copy(w, rd)
 	return
 }
 
+// Move to row n of a stored result, the first row is 0
+func (s *Statement) DataSeek(n uint64) (err os.Error) {
+	if !s.checkResult() {
+		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	return s.result.DataSeek(n)
+}
+
+// Get the current row position of a stored result
+func (s *Statement) RowTell() uint64 {
+	if s.checkResult() {
+		return s.result.RowTell()
+	}
+	return 0
+}
+
+// Set the row position of a stored result using a value from RowTell,
+// returns the previous position
+func (s *Statement) RowSeek(offset uint64) (prev uint64, err os.Error) {
+	if !s.checkResult() {
+		return 0, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	return s.result.RowSeek(offset)
+}
+
+// Get the current field position
+func (s *Statement) FieldTell() uint64 {
+	if s.checkResult() {
+		return s.result.FieldTell()
+	}
+	return 0
+}
+
+// Set the field position for FetchColumn, returns the previous position
+func (s *Statement) FieldSeek(offset uint64) uint64 {
+	if s.checkResult() {
+		return s.result.FieldSeek(offset)
+	}
+	return 0
+}
+
 // Store result
 func (s *Statement) StoreResult() (err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
@@ -482,11 +741,11 @@ func (s *Statement) StoreResult() (err os.Error) {
 	s.c.log(1, "=== Begin store result ===")
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Check if result already used/stored
 	if s.result.mode != RESULT_UNUSED {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Set storage mode
 	s.result.mode = RESULT_STORED
@@ -496,11 +755,21 @@ func (s *Statement) StoreResult() (err os.Error) {
 		return
 	}
 	s.result.allRead = true
+	// Check store limits, the result is freed if exceeded
+	if s.result.storeErr != nil {
+		err = s.result.storeErr
+		s.freeAll(false)
+	}
 	return
 }
 
 // Free result
 func (s *Statement) FreeResult() (err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
@@ -509,11 +778,11 @@ func (s *Statement) FreeResult() (err os.Error) {
 	s.c.log(1, "=== Begin free result ===")
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Check result
 	if !s.checkResult() {
-		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
 	}
 	// Free the current result set
 	s.freeAll(false)
@@ -527,6 +796,11 @@ func (s *Statement) MoreResults() bool {
 
 // Next result
 func (s *Statement) NextResult() (more bool, err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
@@ -535,11 +809,11 @@ func (s *Statement) NextResult() (more bool, err os.Error) {
 	s.c.log(1, "=== Begin next result ===")
 	// Check prepared
 	if !s.prepared {
-		return false, &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return false, &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Pre-run checks
 	if !s.c.checkConn() || s.checkResult() {
-		return false, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return false, &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Check for more results
 	more = s.MoreResults()
@@ -559,6 +833,11 @@ func (s *Statement) NextResult() (more bool, err os.Error) {
 
 // Reset statement
 func (s *Statement) Reset() (err os.Error) {
+	// Lock client
+	err = s.lock()
+	if err != nil {
+		return
+	}
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
@@ -567,11 +846,11 @@ func (s *Statement) Reset() (err os.Error) {
 	s.c.log(1, "=== Begin reset statement ===")
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Pre-run checks
 	if !s.c.checkConn() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Free any results
 	if s.checkResult() {
@@ -592,6 +871,16 @@ func (s *Statement) Reset() (err os.Error) {
 
 // Close statement
 func (s *Statement) Close() (err os.Error) {
+	// Lock client, released once closed
+	err = s.lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if !s.checkResult() {
+			s.c.release(s)
+		}
+	}()
 	// Auto reconnect
 	defer func() {
 		err = s.c.simpleReconnect(err)
@@ -600,28 +889,63 @@ func (s *Statement) Close() (err os.Error) {
 	s.c.log(1, "=== Begin close statement ===")
 	// Check prepared
 	if !s.prepared {
-		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR}
+		return &ClientError{CR_NO_PREPARE_STMT, CR_NO_PREPARE_STMT_STR, nil}
 	}
 	// Pre-run checks
 	if !s.c.checkConn() || s.checkResult() {
-		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR}
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
 	}
 	// Reset client
 	s.reset()
+	s.c.removeStmt(s)
 	// Send command
 	err = s.c.command(COM_STMT_CLOSE, s.statementId)
 	return
 }
 
+// Construct an execute packet for the bound params
+func (s *Statement) executePacket() *packetExecute {
+	p := &packetExecute{
+		command:        byte(COM_STMT_EXECUTE),
+		statementId:    s.statementId,
+		flags:          byte(CURSOR_TYPE_NO_CURSOR),
+		iterationCount: 1,
+		nullBitMap:     s.getNullBitMap(),
+		paramType:      s.paramType,
+		paramData:      s.paramData,
+	}
+	// Add protocol and sequence
+	p.protocol = s.c.protocol
+	p.sequence = s.c.sequence
+	// Add rebound flag
+	if s.paramsRebound {
+		p.newParamsBound = byte(1)
+	}
+	return p
+}
+
 // Reset the statement
 func (s *Statement) reset() {
 	s.AffectedRows = 0
 	s.LastInsertId = 0
 	s.Warnings = 0
+	if s.result != nil {
+		s.result.freeStore()
+	}
 	s.result = nil
 	s.c.reset()
 }
 
+// Check if any params are bound to readers
+func (s *Statement) hasReaders() bool {
+	for _, r := range s.paramReaders {
+		if r != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // Check if a result exists
 func (s *Statement) checkResult() bool {
 	if s.result != nil {
@@ -630,6 +954,29 @@ func (s *Statement) checkResult() bool {
 	return false
 }
 
+// Send a single long data packet, each packet is a new command
+func (s *Statement) sendLongData(num int, data []byte) (err os.Error) {
+	// Construct packet
+	p := &packetLongData{
+		command:     uint8(COM_STMT_SEND_LONG_DATA),
+		statementId: s.statementId,
+		paramNumber: uint16(num),
+		data:        data,
+	}
+	// Add protocol and sequence
+	s.c.sequence = 0
+	p.protocol = s.c.protocol
+	p.sequence = s.c.sequence
+	// Write packet
+	err = s.c.w.writePacket(p)
+	if err != nil {
+		return
+	}
+	// Log write success
+	s.c.log(1, "[%d] Sent long data packet", p.sequence)
+	return
+}
+
 // Get null bit map
 func (s *Statement) getNullBitMap() (nbm []byte) {
 	nbm = make([]byte, (s.paramCount+7)/8)
@@ -667,7 +1014,12 @@ func (s *Statement) getFields() (err os.Error) {
 func (s *Statement) getRow() (eof bool, err os.Error) {
 	// Check for a valid result
 	if s.result == nil {
-		return false, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR}
+		return false, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	// Finish any open column stream
+	err = s.c.closeStream()
+	if err != nil {
+		return
 	}
 	// Read next row packet or EOF
 	s.c.sequence++
@@ -701,7 +1053,7 @@ func (s *Statement) getResult(types packetType) (eof bool, err os.Error) {
 	// Process result packet
 	switch p.(type) {
 	default:
-		err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+		err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, nil}
 	case *packetOK:
 		err = handleOK(p.(*packetOK), s.c, &s.AffectedRows, &s.LastInsertId, &s.Warnings)
 	case *packetError:
@@ -712,7 +1064,7 @@ func (s *Statement) getResult(types packetType) (eof bool, err os.Error) {
 	case *packetPrepareOK:
 		err = handlePrepareOK(p.(*packetPrepareOK), s.c, s)
 	case *packetParameter:
-		err = handleParam(p.(*packetParameter), s.c)
+		err = handleParam(p.(*packetParameter), s.c, s)
 	case *packetField:
 		err = handleField(p.(*packetField), s.c, s.result)
 	case *packetResultSet:
@@ -735,6 +1087,7 @@ func (s *Statement) freeAll(next bool) (err os.Error) {
 		}
 	}
 	// Unset the result
+	s.result.freeStore()
 	s.result = nil
 	// Check for next result
 	if next {
@@ -0,0 +1,260 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Spilled value types
+const (
+	spillNil byte = iota
+	spillInt64
+	spillUint64
+	spillFloat32
+	spillFloat64
+	spillBytes
+	spillString
+	spillDate
+	spillTime
+	spillDateTime
+)
+
+// Spill file struct, holds stored rows in a temporary file
+type spillFile struct {
+	file    *os.File
+	offsets []int64
+	size    int64
+}
+
+// Create a new spill file, the file is removed immediately and only exists
+// while open
+func newSpillFile(dir string) (s *spillFile, err os.Error) {
+	f, err := ioutil.TempFile(dir, "gomysql")
+	if err != nil {
+		return
+	}
+	os.Remove(f.Name())
+	s = &spillFile{file: f}
+	return
+}
+
+// Get the number of rows in the file
+func (s *spillFile) count() uint64 {
+	return uint64(len(s.offsets))
+}
+
+// Write a row to the end of the file
+func (s *spillFile) write(row Row) (err os.Error) {
+	b := new(bytes.Buffer)
+	for _, v := range row {
+		switch t := v.(type) {
+		case nil:
+			b.WriteByte(spillNil)
+		case int64:
+			b.WriteByte(spillInt64)
+			b.Write(i64tob(t))
+		case uint64:
+			b.WriteByte(spillUint64)
+			b.Write(ui64tob(t))
+		case float32:
+			b.WriteByte(spillFloat32)
+			b.Write(f32tob(t))
+		case float64:
+			b.WriteByte(spillFloat64)
+			b.Write(f64tob(t))
+		case []byte:
+			b.WriteByte(spillBytes)
+			b.Write(ui32tob(uint32(len(t))))
+			b.Write(t)
+		case string:
+			b.WriteByte(spillString)
+			b.Write(ui32tob(uint32(len(t))))
+			b.WriteString(t)
+		case Date:
+			b.WriteByte(spillDate)
+			b.Write(ui16tob(t.Year))
+			b.Write([]byte{t.Month, t.Day})
+		case Time:
+			b.WriteByte(spillTime)
+			b.Write([]byte{t.Hour, t.Minute, t.Second})
+		case DateTime:
+			b.WriteByte(spillDateTime)
+			b.Write(ui16tob(t.Year))
+			b.Write([]byte{t.Month, t.Day, t.Hour, t.Minute, t.Second})
+		default:
+			return spillError("unsupported value")
+		}
+	}
+	n, err := s.file.Write(b.Bytes())
+	if err != nil {
+		return spillError(err.String())
+	}
+	s.offsets = append(s.offsets, s.size)
+	s.size += int64(n)
+	return
+}
+
+// Read row n from the file
+func (s *spillFile) read(n uint64) (row Row, err os.Error) {
+	// Recover errors from malformed data
+	defer func() {
+		if e := recover(); e != nil {
+			row = nil
+			err = spillError("malformed data")
+		}
+	}()
+	// Read the row data
+	end := s.size
+	if n+1 < uint64(len(s.offsets)) {
+		end = s.offsets[n+1]
+	}
+	b := make([]byte, end-s.offsets[n])
+	_, err = s.file.ReadAt(b, s.offsets[n])
+	if err != nil {
+		return nil, spillError(err.String())
+	}
+	// Decode values
+	var pos uint64
+	for pos < uint64(len(b)) {
+		var v interface{}
+		typ := b[pos]
+		pos++
+		switch typ {
+		case spillNil:
+			v = nil
+		case spillInt64:
+			v = btoi64(b[pos : pos+8])
+			pos += 8
+		case spillUint64:
+			v = btoui64(b[pos : pos+8])
+			pos += 8
+		case spillFloat32:
+			v = btof32(b[pos : pos+4])
+			pos += 4
+		case spillFloat64:
+			v = btof64(b[pos : pos+8])
+			pos += 8
+		case spillBytes, spillString:
+			l := uint64(btoui32(b[pos : pos+4]))
+			pos += 4
+			if typ == spillString {
+				v = string(b[pos : pos+l])
+			} else {
+				v = b[pos : pos+l]
+			}
+			pos += l
+		case spillDate:
+			v = Date{btoui16(b[pos : pos+2]), b[pos+2], b[pos+3]}
+			pos += 4
+		case spillTime:
+			v = Time{b[pos], b[pos+1], b[pos+2]}
+			pos += 3
+		case spillDateTime:
+			v = DateTime{btoui16(b[pos : pos+2]), b[pos+2], b[pos+3], b[pos+4], b[pos+5], b[pos+6]}
+			pos += 7
+		default:
+			panic("Unknown spilled value type")
+		}
+		row = append(row, v)
+	}
+	return
+}
+
+// Close and remove the file
+func (s *spillFile) close() {
+	s.file.Close()
+	s.offsets = nil
+}
+
+// Spill file error
+func spillError(msg string) os.Error {
+	return &ClientError{CR_RESULT_SPILL_ERROR, Error(fmt.Sprintf(string(CR_RESULT_SPILL_ERROR_STR), msg)), nil}
+}
+
+// Approximate memory used by a row
+func rowSize(row Row) (n uint64) {
+	for _, v := range row {
+		switch t := v.(type) {
+		case []byte:
+			n += uint64(len(t))
+		case string:
+			n += uint64(len(t))
+		default:
+			n += 8
+		}
+	}
+	return
+}
+
+// Add a row to a stored result, rows are kept in memory until the size
+// exceeds Client.SpillBytes and then written to a temporary file. Once a
+// limit is exceeded the remaining rows are discarded and the error is
+// returned by StoreResult
+func (r *Result) storeRow(row Row) {
+	if r.storeErr != nil {
+		return
+	}
+	// Check limits
+	size := rowSize(row)
+	if r.c.MaxStoreRows > 0 && r.storedRows() >= r.c.MaxStoreRows {
+		r.storeErr = &ClientError{CR_RESULT_ROW_LIMIT, r.c.fmtError(CR_RESULT_ROW_LIMIT_STR, r.c.MaxStoreRows), nil}
+		return
+	}
+	if r.c.MaxStoreBytes > 0 && r.size+size > r.c.MaxStoreBytes {
+		r.storeErr = &ClientError{CR_RESULT_SIZE_LIMIT, r.c.fmtError(CR_RESULT_SIZE_LIMIT_STR, r.c.MaxStoreBytes), nil}
+		return
+	}
+	r.size += size
+	// Keep in memory
+	if r.spill == nil && (r.c.SpillBytes == 0 || r.size <= r.c.SpillBytes) {
+		r.rows = append(r.rows, row)
+		return
+	}
+	// Write to temporary file
+	if r.spill == nil {
+		r.c.log(1, "Stored result exceeds %d bytes, writing rows to temporary file", r.c.SpillBytes)
+		r.spill, r.storeErr = newSpillFile(r.c.SpillDir)
+		if r.storeErr != nil {
+			r.storeErr = spillError(r.storeErr.String())
+			return
+		}
+	}
+	r.storeErr = r.spill.write(row)
+}
+
+// Get the number of stored rows
+func (r *Result) storedRows() uint64 {
+	if r.spill != nil {
+		return uint64(len(r.rows)) + r.spill.count()
+	}
+	return uint64(len(r.rows))
+}
+
+// Get stored row n
+func (r *Result) storedRow(n uint64) (Row, os.Error) {
+	if n < uint64(len(r.rows)) {
+		return r.rows[n], nil
+	}
+	if r.spill == nil || n >= r.storedRows() {
+		return nil, &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR, nil}
+	}
+	return r.spill.read(n - uint64(len(r.rows)))
+}
+
+// Free stored rows
+func (r *Result) freeStore() {
+	if r.spill != nil {
+		r.spill.close()
+		r.spill = nil
+	}
+	r.rows = nil
+	r.size = 0
+	r.storeErr = nil
+}
@@ -0,0 +1,426 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"io"
+	"os"
+)
+
+// Packet stream struct, reads a packet payload directly from the connection
+// including payloads split over multiple packets
+type packetStream struct {
+	r        *reader
+	sequence uint8
+	length   uint64
+	remain   uint64
+	more     bool
+	back     []byte
+}
+
+// Begin reading a packet
+func (r *reader) readStream() (ps *packetStream, err os.Error) {
+	ps = &packetStream{r: r}
+	err = ps.next()
+	return
+}
+
+// Read the next packet header
+func (ps *packetStream) next() (err os.Error) {
+	// Read packet length
+	pktLen, err := ps.r.readNumber(3)
+	if err != nil {
+		return ps.netError(err)
+	}
+	// Read sequence
+	pktSeq, err := ps.r.readNumber(1)
+	if err != nil {
+		return ps.netError(err)
+	}
+	// Continuation packets must follow in sequence
+	if ps.more && uint8(pktSeq) != ps.sequence+1 {
+		return &ClientError{CR_COMMANDS_OUT_OF_SYNC, CR_COMMANDS_OUT_OF_SYNC_STR, nil}
+	}
+	ps.sequence = uint8(pktSeq)
+	ps.length += pktLen
+	ps.remain = pktLen
+	ps.more = pktLen == MAX_PACKET_SIZE
+	return
+}
+
+// Read from the packet payload
+func (ps *packetStream) Read(b []byte) (n int, err os.Error) {
+	// Unread bytes
+	if len(ps.back) > 0 {
+		n = copy(b, ps.back)
+		ps.back = ps.back[n:]
+		return
+	}
+	// Move to next packet if needed
+	for ps.remain == 0 {
+		if !ps.more {
+			return 0, os.EOF
+		}
+		err = ps.next()
+		if err != nil {
+			return
+		}
+	}
+	// Read up to end of current packet
+	if uint64(len(b)) > ps.remain {
+		b = b[:ps.remain]
+	}
+	n, err = ps.r.conn.Read(b)
+	ps.remain -= uint64(n)
+	if err != nil {
+		err = ps.netError(err)
+	}
+	return
+}
+
+// Push bytes back to be read again
+func (ps *packetStream) unread(b []byte) {
+	ps.back = append(b, ps.back...)
+}
+
+// Read n bytes from the payload
+func (ps *packetStream) readBytes(n uint64) (b []byte, err os.Error) {
+	b = make([]byte, n)
+	_, err = io.ReadFull(ps, b)
+	if err == os.EOF || err == io.ErrUnexpectedEOF {
+		err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
+	}
+	return
+}
+
+// Read the rest of the payload
+func (ps *packetStream) readAll() (b []byte, err os.Error) {
+	buf := make([]byte, 4096)
+	for {
+		var n int
+		n, err = ps.Read(buf)
+		b = append(b, buf[:n]...)
+		if err == os.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Read a length coded binary, the raw bytes are appended to buf
+func (ps *packetStream) readLcb(buf []byte) (num uint64, null bool, out []byte, err os.Error) {
+	b, err := ps.readBytes(1)
+	if err != nil {
+		return
+	}
+	out = append(buf, b[0])
+	switch b[0] {
+	// NULL column value
+	case 0xfb:
+		null = true
+		return
+	// 2 byte length
+	case 0xfc:
+		b, err = ps.readBytes(2)
+	// 3 byte length
+	case 0xfd:
+		b, err = ps.readBytes(3)
+	// 8 byte length
+	case 0xfe:
+		b, err = ps.readBytes(8)
+	default:
+		num = uint64(b[0])
+		return
+	}
+	if err != nil {
+		return
+	}
+	out = append(out, b...)
+	for i := range b {
+		num |= uint64(b[i]) << (uint(i) * 8)
+	}
+	return
+}
+
+// Read a column value, the raw bytes are appended to buf
+func (ps *packetStream) readValue(f *Field, binary bool, buf []byte) (out []byte, err os.Error) {
+	var n uint64
+	switch {
+	// Text protocol values are all length coded strings
+	case !binary:
+		n, _, buf, err = ps.readLcb(buf)
+	// Fixed length binary types
+	case f.Type == FIELD_TYPE_TINY:
+		n = 1
+	case f.Type == FIELD_TYPE_SHORT, f.Type == FIELD_TYPE_YEAR:
+		n = 2
+	case f.Type == FIELD_TYPE_LONG, f.Type == FIELD_TYPE_INT24, f.Type == FIELD_TYPE_FLOAT:
+		n = 4
+	case f.Type == FIELD_TYPE_LONGLONG, f.Type == FIELD_TYPE_DOUBLE:
+		n = 8
+	// Length coded binary types
+	default:
+		n, _, buf, err = ps.readLcb(buf)
+	}
+	if err != nil {
+		return
+	}
+	b, err := ps.readBytes(n)
+	if err != nil {
+		return
+	}
+	out = append(buf, b...)
+	return
+}
+
+// Convert connection errors
+func (ps *packetStream) netError(err os.Error) os.Error {
+	if _, ok := err.(*ClientError); !ok {
+		return &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, err}
+	}
+	return err
+}
+
+// Column stream struct, reads a single column value from the connection
+type columnStream struct {
+	c      *Client
+	ps     *packetStream
+	remain uint64
+	done   func() os.Error
+	err    os.Error
+}
+
+// Read from the column value, the rest of the row is read at the end of the value
+func (cs *columnStream) Read(b []byte) (n int, err os.Error) {
+	// Finished or failed
+	if cs.done == nil {
+		if cs.err != nil {
+			return 0, cs.err
+		}
+		return 0, os.EOF
+	}
+	// Read up to end of column
+	if cs.remain > 0 {
+		if uint64(len(b)) > cs.remain {
+			b = b[:cs.remain]
+		}
+		n, err = cs.ps.Read(b)
+		cs.remain -= uint64(n)
+		if err == os.EOF {
+			err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
+		}
+		if err != nil {
+			cs.done = nil
+			cs.err = err
+			cs.c.stream = nil
+			return
+		}
+	}
+	// End of column
+	if cs.remain == 0 {
+		err = cs.finish()
+		if err == nil {
+			err = os.EOF
+		}
+	}
+	return
+}
+
+// Read the rest of the row
+func (cs *columnStream) finish() os.Error {
+	if cs.done != nil {
+		cs.err = cs.done()
+		cs.done = nil
+		cs.c.stream = nil
+	}
+	return cs.err
+}
+
+// Discard the rest of the column value and read the rest of the row
+func (cs *columnStream) close() (err os.Error) {
+	b := make([]byte, 4096)
+	for err == nil {
+		_, err = cs.Read(b)
+	}
+	if err == os.EOF {
+		err = nil
+	}
+	return
+}
+
+// Finish any open column stream
+func (c *Client) closeStream() (err os.Error) {
+	if c.stream != nil {
+		c.log(1, "Discarding unread column stream")
+		err = c.stream.close()
+	}
+	return
+}
+
+// Read the next row, column col is returned as a stream and the rest of the
+// row is decoded into row once the stream has been read
+func (c *Client) getRowStream(r *Result, col int, binary bool, after func(row Row) os.Error) (eof bool, row Row, rd io.Reader, err os.Error) {
+	// Check for a valid result
+	if r == nil {
+		return false, nil, nil, &ClientError{CR_NO_RESULT_SET, CR_NO_RESULT_SET_STR, nil}
+	}
+	// Check column
+	if col < 0 || col >= len(r.fields) {
+		return false, nil, nil, &ClientError{CR_INVALID_PARAMETER_NO, CR_INVALID_PARAMETER_NO_STR, nil}
+	}
+	// Binary rows can only stream length coded columns
+	if binary {
+		switch r.fields[col].Type {
+		case FIELD_TYPE_TINY, FIELD_TYPE_SHORT, FIELD_TYPE_YEAR, FIELD_TYPE_LONG, FIELD_TYPE_INT24,
+			FIELD_TYPE_FLOAT, FIELD_TYPE_LONGLONG, FIELD_TYPE_DOUBLE, FIELD_TYPE_DATE, FIELD_TYPE_TIME,
+			FIELD_TYPE_DATETIME, FIELD_TYPE_TIMESTAMP:
+			return false, nil, nil, &ClientError{CR_UNSUPPORTED_PARAM_TYPE, c.fmtError(CR_UNSUPPORTED_PARAM_TYPE_STR, r.fields[col].Type, col), nil}
+		}
+	}
+	// Finish any previous stream
+	err = c.closeStream()
+	if err != nil {
+		return
+	}
+	// Log read result
+	c.log(1, "Reading streamed row packet from server")
+	// Begin reading packet
+	c.sequence++
+	ps, err := c.r.readStream()
+	if err != nil {
+		return
+	}
+	err = c.checkSequence(ps.sequence)
+	if err != nil {
+		return
+	}
+	// Check first byte
+	buf, err := ps.readBytes(1)
+	if err != nil {
+		return
+	}
+	// EOF or error packet, these are small so read and process as normal
+	if (buf[0] == 0xfe && ps.length < 9) || buf[0] == 0xff {
+		var rest []byte
+		rest, err = ps.readAll()
+		if err != nil {
+			return
+		}
+		var p packetReadable
+		p, err = c.r.decodePacket(PACKET_EOF|PACKET_ERROR, ps.sequence, append(buf, rest...))
+		if err != nil {
+			return
+		}
+		switch p.(type) {
+		case *packetEOF:
+			eof = true
+			err = handleEOF(p.(*packetEOF), c)
+		case *packetError:
+			err = handleError(p.(*packetError), c)
+		}
+		return
+	}
+	c.log(1, "[%d] Streaming row packet column %d", ps.sequence, col)
+	// Read columns before the streamed column, a copy of the packet is kept
+	// with the streamed column replaced by NULL
+	var num uint64
+	var null bool
+	if binary {
+		// Null bit map, bit offset is 2
+		var nbm []byte
+		nbm, err = ps.readBytes((r.fieldCount + 9) / 8)
+		if err != nil {
+			return
+		}
+		buf = append(buf, nbm...)
+		for i := 0; i < col; i++ {
+			if nbm[(i+2)/8]&(1<<uint8((i+2)%8)) != 0 {
+				continue
+			}
+			buf, err = ps.readValue(r.fields[i], true, buf)
+			if err != nil {
+				return
+			}
+		}
+		// Streamed column, set the null bit so the value is skipped when decoding
+		null = nbm[(col+2)/8]&(1<<uint8((col+2)%8)) != 0
+		if !null {
+			num, _, _, err = ps.readLcb(nil)
+			buf[1+(col+2)/8] |= 1 << uint8((col+2)%8)
+		}
+	} else {
+		// First byte is the start of the first column
+		ps.unread(buf)
+		buf = nil
+		for i := 0; i < col; i++ {
+			buf, err = ps.readValue(r.fields[i], false, buf)
+			if err != nil {
+				return
+			}
+		}
+		// Streamed column, replaced with NULL
+		num, null, _, err = ps.readLcb(nil)
+		buf = append(buf, 0xfb)
+	}
+	if err != nil {
+		return
+	}
+	// Row returned to the caller, values are set once the stream is finished
+	row = make(Row, len(r.fields))
+	cs := &columnStream{c: c, ps: ps, remain: num}
+	cs.done = func() (err os.Error) {
+		// Read the rest of the row
+		rest, err := ps.readAll()
+		if err != nil {
+			return
+		}
+		buf = append(buf, rest...)
+		// Sequence of the last packet read
+		c.sequence = ps.sequence
+		// Decode and process the row
+		if binary {
+			var p packetReadable
+			p, err = c.r.decodePacket(PACKET_ROW_BINARY, ps.sequence, buf)
+			if err != nil {
+				return
+			}
+			err = handleBinaryRow(p.(*packetRowBinary), c, r)
+		} else {
+			var p packetReadable
+			p, err = c.r.decodePacket(PACKET_ROW, ps.sequence, buf)
+			if err != nil {
+				return
+			}
+			err = handleRow(p.(*packetRowData), c, r)
+		}
+		if err != nil {
+			return
+		}
+		// Copy values, the streamed column is set to its length
+		copy(row, r.rows[0])
+		if null {
+			row[col] = nil
+		} else {
+			row[col] = num
+		}
+		r.rows[0] = row
+		if after != nil {
+			err = after(row)
+		}
+		return
+	}
+	// NULL values have nothing to stream
+	if null {
+		err = cs.finish()
+		return
+	}
+	c.stream = cs
+	rd = cs
+	return
+}
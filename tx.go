@@ -0,0 +1,392 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Transaction isolation levels
+type IsolationLevel uint8
+
+const (
+	ISOLATION_DEFAULT IsolationLevel = iota
+	ISOLATION_READ_UNCOMMITTED
+	ISOLATION_READ_COMMITTED
+	ISOLATION_REPEATABLE_READ
+	ISOLATION_SERIALIZABLE
+)
+
+// Convert to SQL
+func (l IsolationLevel) String() string {
+	switch l {
+	case ISOLATION_READ_UNCOMMITTED:
+		return "READ UNCOMMITTED"
+	case ISOLATION_READ_COMMITTED:
+		return "READ COMMITTED"
+	case ISOLATION_REPEATABLE_READ:
+		return "REPEATABLE READ"
+	case ISOLATION_SERIALIZABLE:
+		return "SERIALIZABLE"
+	}
+	return "DEFAULT"
+}
+
+// Transaction access modes
+type AccessMode uint8
+
+const (
+	ACCESS_DEFAULT AccessMode = iota
+	ACCESS_READ_ONLY
+	ACCESS_READ_WRITE
+)
+
+// Transaction options, the zero value uses the session defaults
+type TxOptions struct {
+	Isolation          IsolationLevel
+	Access             AccessMode
+	ConsistentSnapshot bool
+}
+
+// Get the start transaction statement with modifiers for the options
+func (o TxOptions) startSql() string {
+	var mods []string
+	if o.ConsistentSnapshot {
+		mods = append(mods, "WITH CONSISTENT SNAPSHOT")
+	}
+	switch o.Access {
+	case ACCESS_READ_ONLY:
+		mods = append(mods, "READ ONLY")
+	case ACCESS_READ_WRITE:
+		mods = append(mods, "READ WRITE")
+	}
+	sql := "START TRANSACTION"
+	if len(mods) > 0 {
+		sql += " " + strings.Join(mods, ", ")
+	}
+	return sql
+}
+
+// Transaction struct, nested transactions use savepoints
+type Tx struct {
+	c         *Client
+	parent    *Tx
+	savepoint string
+	seq       int
+	done      bool
+
+	// Nested transaction committed, outermost transaction committed or rolled
+	// back by a statement, by the server or by a reconnect
+	released  bool
+	committed bool
+	aborted   bool
+
+	// Nested transactions and hooks
+	children      []*Tx
+	commitHooks   []func()
+	rollbackHooks []func()
+}
+
+// Begin a new transaction
+func (c *Client) Begin(opts ...TxOptions) (tx *Tx, err os.Error) {
+	// Log begin
+	c.log(1, "=== Begin transaction ===")
+	// Check for an existing transaction
+	if c.InTransaction() {
+		return nil, &ClientError{CR_TRANSACTION_IN_PROGRESS, CR_TRANSACTION_IN_PROGRESS_STR, nil}
+	}
+	// Settle a previous transaction that ended without commit or rollback
+	if c.tx != nil {
+		c.tx.check()
+	}
+	var o TxOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	// Isolation level applies to the next transaction only
+	if o.Isolation != ISOLATION_DEFAULT {
+		err = c.QueryIdempotent("SET TRANSACTION ISOLATION LEVEL " + o.Isolation.String())
+		if err != nil {
+			return
+		}
+	}
+	// Start transaction with modifiers
+	err = c.QueryIdempotent(o.startSql())
+	if err != nil {
+		return
+	}
+	tx = &Tx{c: c}
+	c.tx = tx
+	return
+}
+
+// Begin a nested transaction using a savepoint
+func (t *Tx) Begin() (tx *Tx, err os.Error) {
+	// Log begin
+	t.c.log(1, "=== Begin nested transaction ===")
+	// Check transaction
+	err = t.check()
+	if err != nil {
+		return
+	}
+	name := t.nextSavepoint()
+	err = t.c.Query("SAVEPOINT " + quoteName(name))
+	if err != nil {
+		return
+	}
+	tx = &Tx{c: t.c, parent: t, savepoint: name}
+	t.children = append(t.children, tx)
+	return
+}
+
+// Commit the transaction, nested transactions release their savepoint
+func (t *Tx) Commit() (err os.Error) {
+	// Log commit
+	t.c.log(1, "=== Begin transaction commit ===")
+	// Check transaction
+	err = t.check()
+	if err != nil {
+		return
+	}
+	if t.parent != nil {
+		err = t.c.Query("RELEASE SAVEPOINT " + quoteName(t.savepoint))
+		if err == nil {
+			// Hooks run when the outer transaction ends
+			t.done = true
+			t.released = true
+		}
+		return
+	}
+	err = t.c.Query("COMMIT")
+	switch {
+	// Connection lost during commit, the commit may or may not have happened
+	case t.aborted || (err != nil && t.c.checkNet(err)):
+		t.c.log(1, "Connection lost during commit")
+		t.end()
+		return &ClientError{CR_TRANSACTION_UNKNOWN, CR_TRANSACTION_UNKNOWN_STR, err}
+	case err == nil:
+		t.end()
+		t.runCommit()
+	// Commit failed and the transaction was rolled back
+	case !t.c.InTransaction():
+		t.end()
+		t.runRollback()
+	}
+	return
+}
+
+// Rollback the transaction, nested transactions rollback to their savepoint
+func (t *Tx) Rollback() (err os.Error) {
+	// Log rollback
+	t.c.log(1, "=== Begin transaction rollback ===")
+	// Check transaction, a transaction already rolled back by the server
+	// needs no further action
+	err = t.check()
+	if cErr, ok := err.(*ClientError); ok && cErr.Errno == CR_TRANSACTION_ROLLED_BACK {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	if t.parent != nil {
+		err = t.c.Query("ROLLBACK TO SAVEPOINT " + quoteName(t.savepoint))
+		if err == nil {
+			err = t.c.Query("RELEASE SAVEPOINT " + quoteName(t.savepoint))
+		}
+		if err == nil {
+			t.done = true
+			t.runRollback()
+		}
+		return
+	}
+	err = t.c.Query("ROLLBACK")
+	// Losing the connection also rolls back the transaction
+	if cErr, ok := err.(*ClientError); ok && cErr.Errno == CR_TRANSACTION_LOST {
+		err = nil
+	}
+	if err == nil || !t.c.InTransaction() {
+		t.end()
+		t.runRollback()
+	}
+	return
+}
+
+// Add a function to run once the transaction has been committed, functions
+// added to a nested transaction run when the outer transaction is committed
+func (t *Tx) OnCommit(fn func()) {
+	t.commitHooks = append(t.commitHooks, fn)
+}
+
+// Add a function to run once the transaction has been rolled back, including
+// rollbacks by the server (e.g. on deadlock) and by a reconnect
+func (t *Tx) OnRollback(fn func()) {
+	t.rollbackHooks = append(t.rollbackHooks, fn)
+}
+
+// Create a savepoint
+func (t *Tx) Savepoint(name string) (err os.Error) {
+	// Log savepoint
+	t.c.log(1, "=== Begin savepoint '%s' ===", name)
+	// Check transaction
+	err = t.check()
+	if err != nil {
+		return
+	}
+	return t.c.Query("SAVEPOINT " + quoteName(name))
+}
+
+// Rollback to a savepoint, the savepoint is kept
+func (t *Tx) RollbackTo(name string) (err os.Error) {
+	// Log rollback to savepoint
+	t.c.log(1, "=== Begin rollback to savepoint '%s' ===", name)
+	// Check transaction
+	err = t.check()
+	if err != nil {
+		return
+	}
+	return t.c.Query("ROLLBACK TO SAVEPOINT " + quoteName(name))
+}
+
+// Release a savepoint
+func (t *Tx) Release(name string) (err os.Error) {
+	// Log release savepoint
+	t.c.log(1, "=== Begin release savepoint '%s' ===", name)
+	// Check transaction
+	err = t.check()
+	if err != nil {
+		return
+	}
+	return t.c.Query("RELEASE SAVEPOINT " + quoteName(name))
+}
+
+// Get the outermost transaction
+func (t *Tx) root() *Tx {
+	for t.parent != nil {
+		t = t.parent
+	}
+	return t
+}
+
+// Get a savepoint name for a nested transaction, names are unique within
+// the outermost transaction
+func (t *Tx) nextSavepoint() string {
+	root := t.root()
+	root.seq++
+	return fmt.Sprintf("gomysql_%d", root.seq-1)
+}
+
+// Check the transaction is still open, the server status is checked to
+// detect implicit commits e.g. by DDL statements
+func (t *Tx) check() os.Error {
+	for p := t; p != nil; p = p.parent {
+		if p.done {
+			return &ClientError{CR_TRANSACTION_DONE, CR_TRANSACTION_DONE_STR, nil}
+		}
+	}
+	root := t.root()
+	if root.committed {
+		t.c.log(1, "Transaction was implicitly committed")
+		root.end()
+		root.runCommit()
+		return &ClientError{CR_TRANSACTION_IMPLICIT, CR_TRANSACTION_IMPLICIT_STR, nil}
+	}
+	// Any other end of the transaction is a rollback, e.g. a ROLLBACK query
+	// or a lock wait timeout with innodb_rollback_on_timeout
+	if root.aborted || !t.c.InTransaction() {
+		t.c.log(1, "Transaction was rolled back")
+		root.end()
+		root.runRollback()
+		return &ClientError{CR_TRANSACTION_ROLLED_BACK, CR_TRANSACTION_ROLLED_BACK_STR, nil}
+	}
+	return nil
+}
+
+// End the outermost transaction
+func (t *Tx) end() {
+	t.done = true
+	if t.c.tx == t {
+		t.c.tx = nil
+	}
+}
+
+// Mark the current transaction as rolled back, called when the server rolls
+// back the transaction or the connection is lost
+func (c *Client) abortTx() {
+	if c.tx != nil && !c.tx.aborted && !c.tx.committed {
+		c.log(1, "Transaction rolled back")
+		c.tx.aborted = true
+	}
+}
+
+// Set the server status, if the current transaction has ended it was
+// committed if the last statement commits and rolled back otherwise
+func (c *Client) setStatus(status ServerStatus) {
+	if c.tx != nil && c.serverStatus&SERVER_STATUS_IN_TRANS > 0 && status&SERVER_STATUS_IN_TRANS == 0 {
+		if isCommitQuery(c.lastSql) {
+			if !c.tx.aborted && !c.tx.committed {
+				c.log(1, "Transaction committed")
+				c.tx.committed = true
+			}
+		} else {
+			c.abortTx()
+		}
+	}
+	c.serverStatus = status
+}
+
+// Run the commit hooks of the transaction and any open or committed nested
+// transactions
+func (t *Tx) runCommit() {
+	for _, child := range t.children {
+		if !child.done || child.released {
+			child.done = true
+			child.runCommit()
+		}
+	}
+	for _, fn := range t.commitHooks {
+		fn()
+	}
+}
+
+// Run the rollback hooks of the transaction and any open or committed nested
+// transactions
+func (t *Tx) runRollback() {
+	for _, child := range t.children {
+		if !child.done || child.released {
+			child.done = true
+			child.runRollback()
+		}
+	}
+	for _, fn := range t.rollbackHooks {
+		fn()
+	}
+}
+
+// Check if a statement commits the current transaction, either with COMMIT
+// or implicitly e.g. DDL statements and starting a new transaction
+func isCommitQuery(sql string) bool {
+	sql = strings.ToUpper(strings.TrimLeft(sql, " \t\r\n("))
+	word := sql
+	if i := strings.IndexAny(sql, " \t\r\n(;"); i != -1 {
+		word = sql[:i]
+	}
+	switch word {
+	case "COMMIT", "BEGIN", "START", "ALTER", "CREATE", "DROP", "RENAME", "TRUNCATE", "GRANT", "REVOKE",
+		"LOCK", "UNLOCK", "ANALYZE", "CHECK", "OPTIMIZE", "REPAIR", "CACHE", "FLUSH", "RESET", "INSTALL", "UNINSTALL":
+		return true
+	// Enabling autocommit and setting a password
+	case "SET":
+		return strings.Contains(sql, "AUTOCOMMIT") || strings.Contains(sql, "PASSWORD")
+	}
+	return false
+}
+
+// Quote an identifier
+func quoteName(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
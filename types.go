@@ -45,3 +45,40 @@ type DateTime struct {
 func (d *DateTime) String() string {
 	return fmt.Sprintf("%d-%02d-%02d %02d:%02d:%02d", d.Year, d.Month, d.Day, d.Hour, d.Minute, d.Second)
 }
+
+// Nullable int64, for use with Statement.BindResult
+type NullInt64 struct {
+	Int64 int64
+	Valid bool
+}
+
+// Nullable uint64, for use with Statement.BindResult
+type NullUint64 struct {
+	Uint64 uint64
+	Valid  bool
+}
+
+// Nullable float64, for use with Statement.BindResult
+type NullFloat64 struct {
+	Float64 float64
+	Valid   bool
+}
+
+// Nullable string, for use with Statement.BindResult
+type NullString struct {
+	String string
+	Valid  bool
+}
+
+// Nullable byte slice, for use with Statement.BindResult
+type NullBytes struct {
+	Bytes []byte
+	Valid bool
+}
+
+// Nullable date/time, for use with Statement.BindResult
+// Date and Time columns populate the relevant part of the DateTime
+type NullTime struct {
+	DateTime DateTime
+	Valid    bool
+}
@@ -25,27 +25,36 @@ func newWriter(conn io.ReadWriteCloser) *writer {
 
 // Write packet to the server
 func (w *writer) writePacket(p packetWritable) (err os.Error) {
+	return w.writePackets(p)
+}
+
+// Write multiple packets to the server in a single write
+func (w *writer) writePackets(ps ...packetWritable) (err os.Error) {
 	// Deferred error processing
 	defer func() {
 		if err != nil {
 			// EOF errors
 			if err == os.EOF || err == io.ErrUnexpectedEOF {
-				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR}
+				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, err}
 			}
 			// OpError
 			if _, ok := err.(*net.OpError); ok {
-				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR}
+				err = &ClientError{CR_SERVER_LOST, CR_SERVER_LOST_STR, err}
 			}
 			// Not ClientError, unknown error
 			if _, ok := err.(*ClientError); !ok {
-				err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR}
+				err = &ClientError{CR_UNKNOWN_ERROR, CR_UNKNOWN_ERROR_STR, err}
 			}
 		}
 	}()
 	// Get data in binary format
-	pktData, err := p.write()
-	if err != nil {
-		return
+	var pktData []byte
+	for _, p := range ps {
+		data, err := p.write()
+		if err != nil {
+			return err
+		}
+		pktData = append(pktData, data...)
 	}
 	// Write packet
 	nw, err := w.conn.Write(pktData)
@@ -53,7 +62,7 @@ func (w *writer) writePacket(p packetWritable) (err os.Error) {
 		return
 	}
 	if nw != len(pktData) {
-		err = &ClientError{CR_DATA_TRUNCATED, CR_DATA_TRUNCATED_STR}
+		err = &ClientError{CR_DATA_TRUNCATED, CR_DATA_TRUNCATED_STR, nil}
 	}
 	return
 }
@@ -0,0 +1,153 @@
+// GoMySQL - A MySQL client library for Go
+//
+// Copyright 2010-2011 Phil Bayfield. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// XA transaction id struct
+type Xid struct {
+	FormatId int64
+	Gtrid    []byte
+	Bqual    []byte
+}
+
+// Convert to SQL, values are hex encoded as they may contain any bytes
+func (x *Xid) String() string {
+	return fmt.Sprintf("X'%x',X'%x',%d", x.Gtrid, x.Bqual, x.FormatId)
+}
+
+// Check if 2 xids are the same
+func (x *Xid) Equal(y *Xid) bool {
+	return y != nil && x.FormatId == y.FormatId && bytes.Equal(x.Gtrid, y.Gtrid) && bytes.Equal(x.Bqual, y.Bqual)
+}
+
+// Start an XA transaction, a transaction must not already be in progress
+func (c *Client) XAStart(xid *Xid) (err os.Error) {
+	// Log XA start
+	c.log(1, "=== Begin XA start ===")
+	// Check for an existing transaction
+	if c.InTransaction() {
+		return &ClientError{CR_TRANSACTION_IN_PROGRESS, CR_TRANSACTION_IN_PROGRESS_STR, nil}
+	}
+	err = c.Query("XA START " + xid.String())
+	if err != nil {
+		return
+	}
+	c.xid = xid
+	return
+}
+
+// End an XA transaction, no more statements can be run in the transaction
+func (c *Client) XAEnd(xid *Xid) (err os.Error) {
+	// Log XA end
+	c.log(1, "=== Begin XA end ===")
+	return c.Query("XA END " + xid.String())
+}
+
+// Prepare an XA transaction for commit
+func (c *Client) XAPrepare(xid *Xid) (err os.Error) {
+	// Log XA prepare
+	c.log(1, "=== Begin XA prepare ===")
+	return c.Query("XA PREPARE " + xid.String())
+}
+
+// Commit an XA transaction, onePhase commits an ended but unprepared transaction
+func (c *Client) XACommit(xid *Xid, onePhase bool) (err os.Error) {
+	// Log XA commit
+	c.log(1, "=== Begin XA commit ===")
+	sql := "XA COMMIT " + xid.String()
+	if onePhase {
+		sql += " ONE PHASE"
+	}
+	err = c.Query(sql)
+	c.xaFinish(xid, err)
+	return
+}
+
+// Rollback an XA transaction
+func (c *Client) XARollback(xid *Xid) (err os.Error) {
+	// Log XA rollback
+	c.log(1, "=== Begin XA rollback ===")
+	err = c.Query("XA ROLLBACK " + xid.String())
+	c.xaFinish(xid, err)
+	return
+}
+
+// Get the XA transactions that are prepared on the server
+func (c *Client) XARecover() (xids []*Xid, err os.Error) {
+	// Log XA recover
+	c.log(1, "=== Begin XA recover ===")
+	err = c.Query("XA RECOVER")
+	if err != nil {
+		return
+	}
+	result, err := c.StoreResult()
+	if err != nil {
+		return
+	}
+	rows := result.Rows()
+	for rows.Next() {
+		var xid *Xid
+		xid, err = parseXid(rows.Row())
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		xids = append(xids, xid)
+	}
+	err = rows.Err()
+	rows.Close()
+	return
+}
+
+// Parse a row returned by XA RECOVER, columns are formatID, gtrid_length,
+// bqual_length and data (gtrid followed by bqual)
+func parseXid(row Row) (xid *Xid, err os.Error) {
+	xid = new(Xid)
+	var gl, bl int64
+	var data []byte
+	xid.FormatId, err = row.Int64(0)
+	if err == nil {
+		gl, err = row.Int64(1)
+	}
+	if err == nil {
+		bl, err = row.Int64(2)
+	}
+	if err == nil {
+		data, err = row.Bytes(3)
+	}
+	if err == nil && (gl < 0 || bl < 0 || gl+bl > int64(len(data))) {
+		err = &ClientError{CR_MALFORMED_PACKET, CR_MALFORMED_PACKET_STR, nil}
+	}
+	if err != nil {
+		return nil, err
+	}
+	xid.Gtrid = data[:gl]
+	xid.Bqual = data[gl : gl+bl]
+	return
+}
+
+// Clear the current XA transaction after commit or rollback
+func (c *Client) xaFinish(xid *Xid, err os.Error) {
+	if c.xid == nil || !c.xid.Equal(xid) {
+		return
+	}
+	if err == nil {
+		c.xid = nil
+		return
+	}
+	// A failed commit or rollback may still end the transaction
+	if sErr, ok := AsServerError(err); ok {
+		switch sErr.Errno {
+		case ER_XAER_NOTA, ER_XA_RBROLLBACK, ER_XA_RBTIMEOUT, ER_XA_RBDEADLOCK:
+			c.xid = nil
+		}
+	}
+}